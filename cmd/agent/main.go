@@ -2,24 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/faanross/dns-encryption-simulator/internal/config"
+	"github.com/faanross/dns-encryption-simulator/internal/control"
 	"github.com/faanross/dns-encryption-simulator/internal/dns"
 	"github.com/faanross/dns-encryption-simulator/internal/modes"
+	"github.com/faanross/dns-encryption-simulator/internal/timing"
+	"github.com/faanross/dns-encryption-simulator/internal/tls"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-func main() {
-	// =============================================================================
-	// CONFIGURATION - Customize these values
-	// =============================================================================
-
-	cfg := &config.AgentConfig{
+// defaultConfig is used when no --config file is given
+func defaultConfig() *config.AgentConfig {
+	return &config.AgentConfig{
 		// ========== SELECT MODE HERE ==========
 		Mode: config.ModeDoT, // CHANGE THIS: 1=Plain, 2=DoH, 3=DoT, 4=DoQ
 
@@ -37,12 +41,129 @@ func main() {
 		// ========== MODE 3: DoT SETTINGS ==========
 		DoTServerAddr: "127.0.0.1:8853",
 
+		// ========== MODE 4: DoQ SETTINGS ==========
+		DoQServerAddr: "127.0.0.1:8484",
+
 		// ========== COMMON SETTINGS ==========
 		TargetDomain:       "timeserversync.test",
 		SubdomainMinLength: 45,
 		SubdomainMaxLength: 60,
 		TLSServerName:      "timeserversync.test",
-		InsecureSkipVerify: true, // Allow self-signed certs for testing
+		InsecureSkipVerify: false, // Server auto-generates a CA we can trust; no need to skip verification
+		CAFile:             "./certs/ca.pem",
+		EnablePadding:      false, // Set true to compare traffic with RFC 7830 padding enabled
+	}
+}
+
+func main() {
+	// =============================================================================
+	// FLAGS & CONFIG FILE
+	// =============================================================================
+
+	flags := pflag.NewFlagSet("dns-sim-agent", pflag.ExitOnError)
+	configPath := flags.String("config", "", "path to a YAML agent config file")
+	mode := flags.String("mode", "", "operation mode: plain, doh, dot, or doq")
+	targetDomain := flags.String("target-domain", "", "base domain for beacon queries")
+	resolverAddr := flags.String("resolver-address", "", "plain DNS resolver address")
+	dohURL := flags.String("doh-server-url", "", "DoH endpoint URL")
+	dohMethod := flags.String("doh-method", "", "DoH request method: POST (default) or GET")
+	dohPreferH3 := flags.Bool("doh-prefer-h3", false, "race an HTTP/3 DoH request against HTTP/2 and use whichever answers first")
+	dohForceH3 := flags.Bool("doh-force-h3", false, "send DoH only over HTTP/3, skipping HTTP/2")
+	dotAddr := flags.String("dot-server-addr", "", "DoT server address")
+	dotPinnedSPKI := flags.String("dot-pinned-spki-sha256", "", "pin DoT to a server cert with this hex-encoded SPKI SHA-256 hash")
+	doqAddr := flags.String("doq-server-addr", "", "DoQ server address")
+	caFile := flags.String("ca-file", "", "CA certificate to trust for encrypted modes")
+	insecureSkipVerify := flags.Bool("insecure-skip-verify", false, "skip TLS certificate verification")
+	enablePadding := flags.Bool("enable-padding", false, "attach RFC 7830 padding to outgoing queries")
+	enableCache := flags.Bool("enable-cache", false, "answer repeated queries from a local TTL-aware cache instead of re-sending them")
+	beaconProfile := flags.String("beacon-profile", "", "beacon timing profile: uniform (default), gaussian, poisson, working-hours, or composite")
+	gaussianStdDev := flags.Duration("gaussian-stddev", 0, "standard deviation for the gaussian/composite beacon profiles")
+	poissonLambda := flags.Float64("poisson-lambda", 0, "arrival rate (events/second) for the poisson/composite beacon profiles")
+	workingHoursStart := flags.Int("working-hours-start", 0, "start hour (0-23) of the working-hours beacon profile's high-rate window")
+	workingHoursEnd := flags.Int("working-hours-end", 0, "end hour (0-23) of the working-hours beacon profile's high-rate window")
+	controlPlaneAddr := flags.String("control-plane-addr", "", "control plane server address; empty disables plan reporting")
+	agentID := flags.String("agent-id", "", "this agent's identifier, reported to the control plane")
+	dryRun := flags.Bool("dry-run", false, "validate and print the resolved config, then exit")
+	flags.Parse(os.Args[1:])
+
+	var cfg *config.AgentConfig
+	if *configPath != "" {
+		loaded, err := config.LoadAgentConfig(*configPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to load config: %v", err)
+		}
+		cfg = loaded
+	} else {
+		cfg = defaultConfig()
+	}
+
+	// CLI flags take precedence over both the config file and the defaults
+	if flags.Changed("mode") {
+		parsedMode, err := config.ParseOperationMode(*mode)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		cfg.Mode = parsedMode
+	}
+	if flags.Changed("target-domain") {
+		cfg.TargetDomain = *targetDomain
+	}
+	if flags.Changed("resolver-address") {
+		cfg.ResolverAddress = *resolverAddr
+	}
+	if flags.Changed("doh-server-url") {
+		cfg.DoHServerURL = *dohURL
+	}
+	if flags.Changed("doh-method") {
+		cfg.DoHMethod = *dohMethod
+	}
+	if flags.Changed("doh-prefer-h3") {
+		cfg.DoHPreferH3 = *dohPreferH3
+	}
+	if flags.Changed("doh-force-h3") {
+		cfg.DoHForceH3 = *dohForceH3
+	}
+	if flags.Changed("dot-server-addr") {
+		cfg.DoTServerAddr = *dotAddr
+	}
+	if flags.Changed("dot-pinned-spki-sha256") {
+		cfg.DoTPinnedSPKISHA256 = *dotPinnedSPKI
+	}
+	if flags.Changed("doq-server-addr") {
+		cfg.DoQServerAddr = *doqAddr
+	}
+	if flags.Changed("ca-file") {
+		cfg.CAFile = *caFile
+	}
+	if flags.Changed("insecure-skip-verify") {
+		cfg.InsecureSkipVerify = *insecureSkipVerify
+	}
+	if flags.Changed("enable-padding") {
+		cfg.EnablePadding = *enablePadding
+	}
+	if flags.Changed("enable-cache") {
+		cfg.EnableCache = *enableCache
+	}
+	if flags.Changed("beacon-profile") {
+		cfg.BeaconProfile = *beaconProfile
+	}
+	if flags.Changed("gaussian-stddev") {
+		cfg.GaussianStdDev = *gaussianStdDev
+	}
+	if flags.Changed("poisson-lambda") {
+		cfg.PoissonLambda = *poissonLambda
+	}
+	if flags.Changed("working-hours-start") {
+		cfg.WorkingHoursStartHour = *workingHoursStart
+	}
+	if flags.Changed("working-hours-end") {
+		cfg.WorkingHoursEndHour = *workingHoursEnd
+	}
+	if flags.Changed("control-plane-addr") {
+		cfg.ControlPlaneAddr = *controlPlaneAddr
+	}
+	if flags.Changed("agent-id") {
+		cfg.AgentID = *agentID
 	}
 
 	// =============================================================================
@@ -59,6 +180,17 @@ func main() {
 		log.Fatalf("❌ Configuration error: %v", err)
 	}
 
+	if *dryRun {
+		resolved, err := yaml.Marshal(cfg)
+		if err != nil {
+			log.Fatalf("❌ Failed to render resolved config: %v", err)
+		}
+		fmt.Println("Resolved configuration:")
+		fmt.Println("─────────────────────────────────────────────────")
+		fmt.Print(string(resolved))
+		return
+	}
+
 	// Display configuration
 	fmt.Println("Configuration:")
 	fmt.Println("─────────────────────────────────────────────────")
@@ -66,6 +198,9 @@ func main() {
 	fmt.Printf("  Target Domain:  %s\n", cfg.TargetDomain)
 	fmt.Printf("  Base Delay:     %s\n", cfg.BaseDelay)
 	fmt.Printf("  Jitter:         ±%s\n", cfg.Jitter)
+	if cfg.BeaconProfile != "" && !strings.EqualFold(cfg.BeaconProfile, "uniform") {
+		fmt.Printf("  Beacon Profile: %s\n", cfg.BeaconProfile)
+	}
 	fmt.Printf("  Subdomain Len:  %d-%d chars\n", cfg.SubdomainMinLength, cfg.SubdomainMaxLength)
 
 	// Show mode-specific settings
@@ -79,7 +214,8 @@ func main() {
 		fmt.Printf("  DoT Server:     %s\n", cfg.DoTServerAddr)
 		fmt.Printf("  TLS Verify:     %v\n", !cfg.InsecureSkipVerify)
 	case config.ModeDoQ:
-		fmt.Println("  DoQ:            Not yet implemented")
+		fmt.Printf("  DoQ Server:     %s\n", cfg.DoQServerAddr)
+		fmt.Printf("  TLS Verify:     %v\n", !cfg.InsecureSkipVerify)
 	}
 	fmt.Println()
 
@@ -93,6 +229,17 @@ func main() {
 		log.Fatalf("❌ Failed to create subdomain generator: %v", err)
 	}
 
+	// Load the server's auto-generated CA so we can verify its certificate
+	// without InsecureSkipVerify, unless the user opted into skipping it
+	var rootCAs *x509.CertPool
+	if cfg.Mode != config.ModePlainDNS && !cfg.InsecureSkipVerify && cfg.CAFile != "" {
+		pool, err := tls.LoadCAPool(cfg.CAFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to load CA certificate from %s: %v", cfg.CAFile, err)
+		}
+		rootCAs = pool
+	}
+
 	// Create the appropriate DNS client based on mode
 	var client modes.DNSClient
 
@@ -108,8 +255,21 @@ func main() {
 		if cfg.InsecureSkipVerify {
 			fmt.Printf("⚠️  WARNING: TLS certificate verification disabled (testing mode)\n")
 		}
+		dohMethod := modes.MethodPOST
+		if strings.EqualFold(cfg.DoHMethod, "GET") {
+			dohMethod = modes.MethodGET
+		}
+		if cfg.DoHForceH3 {
+			fmt.Printf("Transport: HTTP/3 only\n")
+		} else if cfg.DoHPreferH3 {
+			fmt.Printf("Transport: racing HTTP/3 against HTTP/2\n")
+		}
 		fmt.Println()
-		client = modes.NewDoHClient(cfg.DoHServerURL, 10*time.Second, cfg.InsecureSkipVerify)
+		client = modes.NewDoHClientWithOptions(cfg.DoHServerURL, 10*time.Second, cfg.InsecureSkipVerify, rootCAs, cfg.EnablePadding, modes.DoHOptions{
+			Method:   dohMethod,
+			PreferH3: cfg.DoHPreferH3,
+			ForceH3:  cfg.DoHForceH3,
+		})
 
 	case config.ModeDoT:
 		fmt.Printf("Using DoT server: %s\n", cfg.DoTServerAddr)
@@ -118,19 +278,67 @@ func main() {
 			fmt.Printf("⚠️  WARNING: TLS certificate verification disabled (testing mode)\n")
 		}
 		fmt.Println()
-		client = modes.NewDoTClient(cfg.DoTServerAddr, cfg.TLSServerName, 10*time.Second, cfg.InsecureSkipVerify)
+		dotClient := modes.NewDoTClientWithPool(cfg.DoTServerAddr, cfg.TLSServerName, 10*time.Second, cfg.InsecureSkipVerify, rootCAs, cfg.EnablePadding, modes.DoTPoolOptions{
+			IdleTimeout: cfg.DoTIdleTimeout,
+			MaxInFlight: cfg.DoTMaxInFlight,
+		})
+		if cfg.DoTPinnedSPKISHA256 != "" {
+			fmt.Printf("Pinning DoT server certificate to SPKI hash: %s\n", cfg.DoTPinnedSPKISHA256)
+			if err := dotClient.EnableSPKIPinning(cfg.DoTPinnedSPKISHA256); err != nil {
+				log.Fatalf("❌ Invalid --dot-pinned-spki-sha256: %v", err)
+			}
+		}
+		client = dotClient
 
 	case config.ModeDoQ:
-		log.Fatalf("❌ Mode 4 (DoQ) not yet implemented - coming in Phase 7")
+		fmt.Printf("Using DoQ server: %s\n", cfg.DoQServerAddr)
+		fmt.Printf("TLS Server Name: %s\n", cfg.TLSServerName)
+		if cfg.InsecureSkipVerify {
+			fmt.Printf("⚠️  WARNING: TLS certificate verification disabled (testing mode)\n")
+		}
+		fmt.Println()
+		client = modes.NewDoQClientWithPool(cfg.DoQServerAddr, cfg.TLSServerName, 10*time.Second, cfg.InsecureSkipVerify, rootCAs, cfg.EnablePadding, modes.DoQPoolOptions{
+			IdleTimeout: cfg.DoQIdleTimeout,
+			MaxInFlight: cfg.DoQMaxInFlight,
+		})
 
 	default:
 		log.Fatalf("❌ Invalid mode: %d", cfg.Mode)
 	}
 
+	// Wire up the control plane, if configured, so the server can join this
+	// agent's plan against what it actually observes. Only
+	// PlainDNSClientAdapter and DoTClient have hooks for this so far.
+	if cfg.ControlPlaneAddr != "" {
+		controlClient := control.NewClient(cfg.ControlPlaneAddr, 5*time.Second)
+		if err := controlClient.RegisterAgent(cfg.AgentID); err != nil {
+			log.Fatalf("❌ Failed to register with control plane at %s: %v", cfg.ControlPlaneAddr, err)
+		}
+		fmt.Printf("Reporting query plans to control plane: %s (agent %q)\n\n", cfg.ControlPlaneAddr, cfg.AgentID)
+
+		switch c := client.(type) {
+		case *modes.PlainDNSClientAdapter:
+			c.EnableControlPlane(controlClient, cfg.AgentID)
+		case *modes.DoTClient:
+			c.EnableControlPlane(controlClient, cfg.AgentID)
+		}
+	}
+
+	// Wrap with a client-side cache last, after the control plane hookup so
+	// the type switch above still sees the underlying client.
+	if cfg.EnableCache {
+		fmt.Printf("Client-side cache: enabled (max %d entries)\n\n", cfg.CacheMaxEntries)
+		client = modes.NewCachingClient(client, cfg.CacheMaxEntries, cfg.CacheNegativeTTL)
+	}
+
 	defer client.Close()
 
 	// Create beacon
-	beacon := dns.NewBeacon(client, generator, cfg.TargetDomain, cfg.BaseDelay, cfg.Jitter)
+	scheduler, err := buildScheduler(cfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	beacon := dns.NewBeaconWithScheduler(client, generator, cfg.TargetDomain, scheduler)
 
 	// =============================================================================
 	// SET UP SIGNAL HANDLING
@@ -161,3 +369,52 @@ func main() {
 		}
 	}
 }
+
+// buildScheduler constructs the timing.Scheduler named by cfg.BeaconProfile,
+// mirroring cmd/servedoh's buildBackend: each profile name maps to one of
+// internal/timing's Scheduler implementations, so GaussianJitter/
+// PoissonBeacon/WorkingHours/Composite are reachable from the shipped agent
+// binary instead of only BaseDelay/Jitter's uniform default.
+func buildScheduler(cfg *config.AgentConfig) (timing.Scheduler, error) {
+	uniform := timing.NewUniformJitter(cfg.BaseDelay, cfg.Jitter)
+
+	switch strings.ToLower(cfg.BeaconProfile) {
+	case "", "uniform":
+		return uniform, nil
+
+	case "gaussian":
+		stdDev := cfg.GaussianStdDev
+		if stdDev <= 0 {
+			stdDev = cfg.Jitter
+		}
+		return timing.NewGaussianJitter(cfg.BaseDelay, stdDev), nil
+
+	case "poisson":
+		lambda := cfg.PoissonLambda
+		if lambda <= 0 {
+			lambda = 1 / cfg.BaseDelay.Seconds()
+		}
+		return timing.NewPoissonBeacon(lambda), nil
+
+	case "working-hours":
+		start, end := cfg.WorkingHoursStartHour, cfg.WorkingHoursEndHour
+		if start == 0 && end == 0 {
+			start, end = 9, 17
+		}
+		return timing.NewWorkingHours(start, end, uniform, timing.NewUniformJitter(cfg.BaseDelay*4, cfg.Jitter)), nil
+
+	case "composite":
+		lambda := cfg.PoissonLambda
+		if lambda <= 0 {
+			lambda = 1 / cfg.BaseDelay.Seconds()
+		}
+		stdDev := cfg.GaussianStdDev
+		if stdDev <= 0 {
+			stdDev = cfg.Jitter
+		}
+		return timing.NewComposite(timing.NewPoissonBeacon(lambda), timing.NewGaussianJitter(0, stdDev)), nil
+
+	default:
+		return nil, fmt.Errorf("unknown beacon profile %q: expected uniform, gaussian, poisson, working-hours, or composite", cfg.BeaconProfile)
+	}
+}
@@ -0,0 +1,110 @@
+// Command servedoh runs modes.DoHServer as a standalone DoH gateway: it
+// terminates RFC 8484 over HTTPS and forwards every query to a backend
+// DNSClient (plain, DoT, DoH, or DoQ) parsed from --upstream, the way
+// dnss chains DNS-to-HTTPS -> HTTPS-to-DNS -> DNS. Unlike cmd/server, which
+// answers from its own authoritative zone, servedoh has no zone of its
+// own — its only job is unwrapping encrypted queries onto --upstream.
+//
+// Example: dns-sim-servedoh --listen 127.0.0.1:8443 --upstream udp://1.1.1.1:53
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/faanross/dns-encryption-simulator/internal/modes"
+	ourtls "github.com/faanross/dns-encryption-simulator/internal/tls"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	flags := pflag.NewFlagSet("dns-sim-servedoh", pflag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8443", "address for the DoH gateway to listen on")
+	upstream := flags.String("upstream", "", "backend to forward queries to: udp://host:port, tls://host:port, https://host/path, or quic://host:port")
+	certFile := flags.String("cert-file", "./certs/server.crt", "TLS certificate for the gateway's own HTTPS listener")
+	keyFile := flags.String("key-file", "./certs/server.key", "TLS private key for the gateway's own HTTPS listener")
+	caFile := flags.String("ca-file", "", "CA certificate to trust for an encrypted upstream")
+	insecureSkipVerify := flags.Bool("insecure-skip-verify", false, "skip TLS certificate verification against the upstream")
+	flags.Parse(os.Args[1:])
+
+	if *upstream == "" {
+		log.Fatal("❌ --upstream is required, e.g. --upstream udp://1.1.1.1:53")
+	}
+
+	if err := ourtls.EnsureCertificate(*certFile, *keyFile, "./certs/ca.pem", "localhost"); err != nil {
+		log.Fatalf("❌ Failed to prepare TLS certificate: %v", err)
+	}
+
+	var rootCAs *x509.CertPool
+	if *caFile != "" {
+		pool, err := ourtls.LoadCAPool(*caFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to load CA certificate from %s: %v", *caFile, err)
+		}
+		rootCAs = pool
+	}
+
+	backend, err := buildBackend(*upstream, rootCAs, *insecureSkipVerify)
+	if err != nil {
+		log.Fatalf("❌ Invalid --upstream %q: %v", *upstream, err)
+	}
+	defer backend.Close()
+
+	server := modes.NewDoHServer(backend, *listen, *certFile, *keyFile)
+
+	errChan := make(chan error, 1)
+	go func() {
+		if err := server.Start(); err != nil {
+			errChan <- err
+		}
+	}()
+
+	fmt.Printf("✓ DoH gateway listening on https://%s/dns-query -> %s\n", *listen, *upstream)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case sig := <-sigChan:
+		fmt.Printf("\nReceived signal: %v, shutting down...\n", sig)
+		_ = server.Stop()
+	case err := <-errChan:
+		log.Fatalf("❌ DoH gateway error: %v", err)
+	}
+}
+
+// buildBackend constructs the modes.DNSClient named by rawUpstream's scheme,
+// mirroring internal/dns.parseUpstream's scheme set but returning a
+// DNSClient (domain-at-a-time) rather than an arbitrary-message upstream,
+// since that's what modes.DoHServer forwards through.
+func buildBackend(rawUpstream string, rootCAs *x509.CertPool, insecureSkipVerify bool) (modes.DNSClient, error) {
+	u, err := url.Parse(rawUpstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address: %w", err)
+	}
+
+	const timeout = 10 * time.Second
+
+	switch u.Scheme {
+	case "udp":
+		return modes.NewPlainDNSClientAdapter(u.Host, timeout), nil
+
+	case "tls":
+		return modes.NewDoTClient(u.Host, u.Hostname(), timeout, insecureSkipVerify, rootCAs, false), nil
+
+	case "https":
+		return modes.NewDoHClient(rawUpstream, timeout, insecureSkipVerify, rootCAs, false), nil
+
+	case "quic":
+		return modes.NewDoQClient(u.Host, u.Hostname(), timeout, insecureSkipVerify, rootCAs, false), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.Scheme)
+	}
+}
@@ -10,33 +10,203 @@ import (
 	"time"
 
 	"github.com/faanross/dns-encryption-simulator/internal/config"
+	"github.com/faanross/dns-encryption-simulator/internal/control"
 	"github.com/faanross/dns-encryption-simulator/internal/dns"
+	"github.com/faanross/dns-encryption-simulator/internal/metrics"
+	"github.com/faanross/dns-encryption-simulator/internal/tls"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-func main() {
-	// =============================================================================
-	// CONFIGURATION - Customize these values
-	// =============================================================================
+// caCertFile is where the auto-generated CA certificate is written so the
+// agent can load it as a trusted root instead of disabling verification
+const caCertFile = "./certs/ca.pem"
+
+// withControlObserver wraps next so hub (if non-nil) observes every query
+// this listener receives, under transport's label. Returns next unchanged
+// when the control plane is disabled.
+func withControlObserver(next dns.Handler, hub *control.Hub, transport string) dns.Handler {
+	if hub == nil {
+		return next
+	}
+	return dns.NewControlObserverHandler(next, hub, transport)
+}
 
-	cfg := &config.ServerConfig{
+// defaultConfig is used when no --config file is given
+func defaultConfig() *config.ServerConfig {
+	return &config.ServerConfig{
 		Domain:     "timeserversync.test",
 		ResponseIP: "127.0.0.1",
 		TTL:        60,
 
 		// Enable protocols
-		EnablePlainDNS: true,  // Plain DNS on port 15353
-		EnableDoH:      true,  // DoH on port 8443
-		EnableDoT:      true,  // Not yet implemented
-		EnableDoQ:      false, // Not yet implemented
+		EnablePlainDNS: true, // Plain DNS on port 15353
+		EnableDoH:      true, // DoH on port 8443
+		EnableDoT:      true, // DoT on port 8853
+		EnableDoQ:      true, // DoQ on port 8484
+
+		PlainDNSAddr: "127.0.0.1:15353",
+		DoHAddr:      "127.0.0.1:8443",
+		DoTAddr:      "127.0.0.1:8853",
+		DoQAddr:      "127.0.0.1:8484",
 
 		// TLS Configuration (for DoH, DoT, DoQ)
 		TLSCertFile: "./certs/server.crt",
 		TLSKeyFile:  "./certs/server.key",
 
+		// Upstream forwarding (nil keeps the server authoritative-only).
+		// Example to turn this into a DoH gateway:
+		// Upstream: &config.UpstreamConfig{Address: "https://dns.google/dns-query", BootstrapResolver: "8.8.8.8:53", Timeout: 5},
+		Upstream: nil,
+
+		// Response cache (nil disables caching)
+		Cache: &config.CacheConfig{
+			MaxEntries:  10000,
+			NegativeTTL: 30 * time.Second,
+		},
+
+		// EDNS(0) padding on the encrypted listeners, so researchers can
+		// compare ciphertext lengths with and without RFC 7830 padding
+		EnablePadding: false,
+
+		// Prometheus /metrics endpoint (empty uses metrics.DefaultAddr)
+		MetricsAddr: "",
+
 		// Logging
 		LogQueries: true,
 		Verbose:    true,
 	}
+}
+
+func main() {
+	// =============================================================================
+	// FLAGS & CONFIG FILE
+	// =============================================================================
+
+	flags := pflag.NewFlagSet("dns-sim-server", pflag.ExitOnError)
+	configPath := flags.String("config", "", "path to a YAML server config file")
+	domain := flags.String("domain", "", "authoritative domain")
+	responseIP := flags.String("response-ip", "", "IP address returned in A record responses")
+	ttl := flags.Uint32("ttl", 0, "response TTL in seconds")
+	enablePlainDNS := flags.Bool("enable-plain-dns", false, "enable the plain DNS (UDP) listener")
+	enableDoH := flags.Bool("enable-doh", false, "enable the DoH listener")
+	enableDoT := flags.Bool("enable-dot", false, "enable the DoT listener")
+	enableDoQ := flags.Bool("enable-doq", false, "enable the DoQ listener")
+	plainPort := flags.Int("plain-port", 0, "port for the plain DNS listener")
+	dohPort := flags.Int("doh-port", 0, "port for the DoH listener")
+	dotPort := flags.Int("dot-port", 0, "port for the DoT listener")
+	doqPort := flags.Int("doq-port", 0, "port for the DoQ listener")
+	certFile := flags.String("tls-cert-file", "", "path to the TLS certificate")
+	keyFile := flags.String("tls-key-file", "", "path to the TLS private key")
+	enablePadding := flags.Bool("enable-padding", false, "attach RFC 7830 padding to encrypted responses")
+	metricsAddr := flags.String("metrics-addr", "", "address for the Prometheus /metrics endpoint")
+	enableDNSSEC := flags.Bool("enable-dnssec", false, "sign responses and synthesize NSEC/NSEC3 denial for DO-bit queries")
+	zoneKeyFile := flags.String("zone-key-file", "", "path to the zone's KSK+ZSK, generated on first run if missing")
+	nsec3Salt := flags.String("nsec3-salt", "", "hex-encoded NSEC3 salt; empty uses plain NSEC instead")
+	enableControlPlane := flags.Bool("enable-control-plane", false, "start the control plane server for agent-reported query plans")
+	controlPlaneListen := flags.String("control-plane-listen", "", "address the control plane server binds to")
+	controlReportFile := flags.String("control-report-file", "", "path to append the planned-vs-observed joined report as JSONL")
+	logQueries := flags.Bool("log-queries", false, "log every query to stdout")
+	verbose := flags.Bool("verbose", false, "enable verbose debug logging")
+	dryRun := flags.Bool("dry-run", false, "validate and print the resolved config, then exit")
+	flags.Parse(os.Args[1:])
+
+	var cfg *config.ServerConfig
+	if *configPath != "" {
+		loaded, err := config.LoadServerConfig(*configPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to load config: %v", err)
+		}
+		cfg = loaded
+	} else {
+		cfg = defaultConfig()
+	}
+
+	// CLI flags take precedence over both the config file and the defaults
+	if flags.Changed("domain") {
+		cfg.Domain = *domain
+	}
+	if flags.Changed("response-ip") {
+		cfg.ResponseIP = *responseIP
+	}
+	if flags.Changed("ttl") {
+		cfg.TTL = *ttl
+	}
+	if flags.Changed("enable-plain-dns") {
+		cfg.EnablePlainDNS = *enablePlainDNS
+	}
+	if flags.Changed("enable-doh") {
+		cfg.EnableDoH = *enableDoH
+	}
+	if flags.Changed("enable-dot") {
+		cfg.EnableDoT = *enableDoT
+	}
+	if flags.Changed("enable-doq") {
+		cfg.EnableDoQ = *enableDoQ
+	}
+	if flags.Changed("plain-port") {
+		cfg.PlainDNSAddr = config.WithPort(cfg.PlainDNSAddr, *plainPort)
+	}
+	if flags.Changed("doh-port") {
+		cfg.DoHAddr = config.WithPort(cfg.DoHAddr, *dohPort)
+	}
+	if flags.Changed("dot-port") {
+		cfg.DoTAddr = config.WithPort(cfg.DoTAddr, *dotPort)
+	}
+	if flags.Changed("doq-port") {
+		cfg.DoQAddr = config.WithPort(cfg.DoQAddr, *doqPort)
+	}
+	if flags.Changed("tls-cert-file") {
+		cfg.TLSCertFile = *certFile
+	}
+	if flags.Changed("tls-key-file") {
+		cfg.TLSKeyFile = *keyFile
+	}
+	if flags.Changed("enable-padding") {
+		cfg.EnablePadding = *enablePadding
+	}
+	if flags.Changed("metrics-addr") {
+		cfg.MetricsAddr = *metricsAddr
+	}
+	if flags.Changed("enable-dnssec") {
+		cfg.EnableDNSSEC = *enableDNSSEC
+	}
+	if flags.Changed("zone-key-file") {
+		cfg.ZoneKeyFile = *zoneKeyFile
+	}
+	if flags.Changed("nsec3-salt") {
+		cfg.NSEC3Salt = *nsec3Salt
+	}
+	if flags.Changed("enable-control-plane") {
+		cfg.EnableControlPlane = *enableControlPlane
+	}
+	if flags.Changed("control-plane-listen") {
+		cfg.ControlPlaneListen = *controlPlaneListen
+	}
+	if flags.Changed("control-report-file") {
+		cfg.ControlReportFile = *controlReportFile
+	}
+	if flags.Changed("log-queries") {
+		cfg.LogQueries = *logQueries
+	}
+	if flags.Changed("verbose") {
+		cfg.Verbose = *verbose
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("❌ Configuration error: %v", err)
+	}
+
+	if *dryRun {
+		resolved, err := yaml.Marshal(cfg)
+		if err != nil {
+			log.Fatalf("❌ Failed to render resolved config: %v", err)
+		}
+		fmt.Println("Resolved configuration:")
+		fmt.Println("─────────────────────────────────────────────────")
+		fmt.Print(string(resolved))
+		return
+	}
 
 	// =============================================================================
 	// INITIALIZATION
@@ -54,15 +224,27 @@ func main() {
 	fmt.Printf("  Response IP: %s\n", cfg.ResponseIP)
 	fmt.Printf("  TTL:         %d seconds\n", cfg.TTL)
 	fmt.Println("\nEnabled Protocols:")
-	fmt.Printf("  Plain DNS:   %v (port 15353)\n", cfg.EnablePlainDNS)
-	fmt.Printf("  DoH:         %v (port 8443)\n", cfg.EnableDoH)
-	fmt.Printf("  DoT:         %v (port 8853)\n", cfg.EnableDoT)
-	fmt.Printf("  DoQ:         %v\n", cfg.EnableDoQ)
+	fmt.Printf("  Plain DNS:   %v (%s)\n", cfg.EnablePlainDNS, cfg.PlainDNSAddr)
+	fmt.Printf("  DoH:         %v (%s)\n", cfg.EnableDoH, cfg.DoHAddr)
+	fmt.Printf("  DoT:         %v (%s)\n", cfg.EnableDoT, cfg.DoTAddr)
+	fmt.Printf("  DoQ:         %v (%s)\n", cfg.EnableDoQ, cfg.DoQAddr)
+
+	resolvedMetricsAddr := cfg.MetricsAddr
+	if resolvedMetricsAddr == "" {
+		resolvedMetricsAddr = metrics.DefaultAddr
+	}
+	fmt.Printf("\nMetrics:       http://%s/metrics\n", resolvedMetricsAddr)
 
 	if cfg.EnableDoH || cfg.EnableDoT || cfg.EnableDoQ {
 		fmt.Println("\nTLS Configuration:")
 		fmt.Printf("  Certificate: %s\n", cfg.TLSCertFile)
 		fmt.Printf("  Private Key: %s\n", cfg.TLSKeyFile)
+
+		// Generate a self-signed CA + leaf certificate on first run so users
+		// don't have to run openssl before the encrypted listeners work
+		if err := tls.EnsureCertificate(cfg.TLSCertFile, cfg.TLSKeyFile, caCertFile, cfg.Domain); err != nil {
+			log.Fatalf("❌ Failed to provision TLS certificate: %v", err)
+		}
 	}
 	fmt.Println()
 
@@ -82,13 +264,91 @@ func main() {
 		log.Fatalf("❌ Failed to create DNS handler: %v", err)
 	}
 
+	// If an upstream is configured, wrap the handler so out-of-zone queries
+	// are forwarded instead of NXDOMAIN'd. Stats always come from the
+	// underlying *Server regardless of which handler actually serves traffic.
+	var servingHandler dns.Handler = handler
+	if cfg.Upstream != nil {
+		fmt.Printf("Forwarding out-of-zone queries to: %s\n\n", cfg.Upstream.Address)
+		forwarder, err := dns.NewForwardingHandler(handler, *cfg.Upstream)
+		if err != nil {
+			log.Fatalf("❌ Failed to configure upstream forwarding: %v", err)
+		}
+		defer forwarder.Close()
+		servingHandler = forwarder
+	}
+
+	// Wrap with the shared response cache, if enabled, so repeated beacon
+	// queries (and forwarded lookups) don't re-hit the handler every time
+	var cachingHandler *dns.CachingHandler
+	if cfg.Cache != nil {
+		cachingHandler = dns.NewCachingHandler(servingHandler, cfg.Cache.MaxEntries, cfg.Cache.NegativeTTL)
+		servingHandler = cachingHandler
+	}
+
+	// DNSSEC signing, if enabled, applies to every listener equally — the
+	// DO bit can be set over any transport, not just the encrypted ones.
+	if cfg.EnableDNSSEC {
+		fmt.Printf("Signing DO-bit responses with zone key: %s\n\n", cfg.ZoneKeyFile)
+		signer, err := dns.NewDNSSECSigner(cfg.Domain, cfg.ZoneKeyFile, cfg.TTL, 0, 0, cfg.NSEC3Salt)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialize DNSSEC signer: %v", err)
+		}
+		servingHandler = dns.NewDNSSECHandler(servingHandler, signer, cfg.Domain, cfg.TTL)
+	}
+
+	// Padding only applies to the encrypted listeners: it hides response
+	// size from ciphertext length, which plain UDP DNS has no way to do
+	encryptedHandler := servingHandler
+	if cfg.EnablePadding {
+		encryptedHandler = dns.NewPaddingHandler(servingHandler)
+	}
+
 	// Track running servers
 	var wg sync.WaitGroup
 	errChan := make(chan error, 2)
 
+	// The control plane, if enabled, lets agents pre-declare the queries
+	// they're about to send so every listener's handler can join that plan
+	// against what it actually receives.
+	var controlHub *control.Hub
+	if cfg.EnableControlPlane {
+		reportFile, err := os.OpenFile(cfg.ControlReportFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("❌ Failed to open control report file %s: %v", cfg.ControlReportFile, err)
+		}
+		defer reportFile.Close()
+
+		controlHub = control.NewHub(reportFile, cfg.Domain, cfg.ResponseIP)
+
+		controlServer := control.NewServer(controlHub, cfg.ControlPlaneListen)
+		defer controlServer.Stop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := controlServer.Start(); err != nil {
+				errChan <- fmt.Errorf("control plane server error: %w", err)
+			}
+		}()
+
+		fmt.Printf("Control plane:  http://%s (report: %s)\n", cfg.ControlPlaneListen, cfg.ControlReportFile)
+	}
+
+	// Start the Prometheus /metrics endpoint, so DoH/DoT/DoQ overhead can be
+	// measured rather than just eyeballed from the stats printer below
+	metricsServer := metrics.NewServer(cfg.MetricsAddr)
+	defer metricsServer.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := metricsServer.Start(); err != nil {
+			errChan <- fmt.Errorf("metrics server error: %w", err)
+		}
+	}()
+
 	// Start Plain DNS server
 	if cfg.EnablePlainDNS {
-		plainServer := dns.NewPlainDNSServer(handler, "127.0.0.1:15353")
+		plainServer := dns.NewPlainDNSServer(dns.NewMetricsHandler(withControlObserver(servingHandler, controlHub, "plain"), "plain"), cfg.PlainDNSAddr)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -100,7 +360,7 @@ func main() {
 
 	// Start DoH server
 	if cfg.EnableDoH {
-		dohServer := dns.NewDoHServer(handler, "127.0.0.1:8443", cfg.TLSCertFile, cfg.TLSKeyFile)
+		dohServer := dns.NewDoHServer(dns.NewMetricsHandler(withControlObserver(encryptedHandler, controlHub, "doh"), "doh"), cfg.DoHAddr, cfg.TLSCertFile, cfg.TLSKeyFile)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -112,7 +372,7 @@ func main() {
 
 	// Start DoT server
 	if cfg.EnableDoT {
-		dotServer := dns.NewDoTServer(handler, "127.0.0.1:8853", cfg.TLSCertFile, cfg.TLSKeyFile)
+		dotServer := dns.NewDoTServer(dns.NewMetricsHandler(withControlObserver(encryptedHandler, controlHub, "dot"), "dot"), cfg.DoTAddr, cfg.TLSCertFile, cfg.TLSKeyFile)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -122,6 +382,18 @@ func main() {
 		}()
 	}
 
+	// Start DoQ server
+	if cfg.EnableDoQ {
+		doqServer := dns.NewDoQServer(dns.NewMetricsHandler(withControlObserver(encryptedHandler, controlHub, "doq"), "doq"), cfg.DoQAddr, cfg.TLSCertFile, cfg.TLSKeyFile)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := doqServer.Start(); err != nil {
+				errChan <- fmt.Errorf("DoQ server error: %w", err)
+			}
+		}()
+	}
+
 	// Give servers a moment to start
 	time.Sleep(500 * time.Millisecond)
 
@@ -142,8 +414,15 @@ func main() {
 			case <-ticker.C:
 				queryCount, uptime := handler.GetStats()
 				qps := float64(queryCount) / uptime.Seconds()
-				fmt.Printf("\n📊 Stats: %d queries | Uptime: %s | Avg: %.2f q/s\n\n",
+				fmt.Printf("\n📊 Stats: %d queries | Uptime: %s | Avg: %.2f q/s\n",
 					queryCount, uptime.Round(time.Second), qps)
+				if cachingHandler != nil {
+					cacheStats := cachingHandler.GetStats()
+					fmt.Printf("  └─ Cache: %d hits | %d misses | %d evictions | %d entries\n\n",
+						cacheStats.Hits, cacheStats.Misses, cacheStats.Evictions, cacheStats.Entries)
+				} else {
+					fmt.Println()
+				}
 			case <-sigChan:
 				return
 			}
@@ -171,6 +450,11 @@ func main() {
 			qps := float64(queryCount) / uptime.Seconds()
 			fmt.Printf("  Average QPS:   %.2f\n", qps)
 		}
+		if cachingHandler != nil {
+			cacheStats := cachingHandler.GetStats()
+			fmt.Printf("  Cache:         %d hits, %d misses, %d evictions, %d entries\n",
+				cacheStats.Hits, cacheStats.Misses, cacheStats.Evictions, cacheStats.Entries)
+		}
 
 		fmt.Println("\n✓ Shutdown complete")
 
@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// CacheConfig controls the shared in-memory response cache. A nil
+// *CacheConfig on ServerConfig disables caching entirely.
+type CacheConfig struct {
+	// MaxEntries bounds the cache's LRU (0 falls back to a sensible default)
+	MaxEntries int
+
+	// NegativeTTL is how long NXDOMAIN/NODATA answers are cached for
+	NegativeTTL time.Duration
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -58,6 +59,29 @@ type AgentConfig struct {
 	// If BaseDelay=5s and Jitter=2s, actual delay will be between 3-7 seconds
 	Jitter time.Duration
 
+	// BeaconProfile selects which internal/timing.Scheduler drives the
+	// beacon loop: "uniform" (default, BaseDelay±Jitter), "gaussian"
+	// (Normal(BaseDelay, GaussianStdDev)), "poisson" (Exponential(PoissonLambda)),
+	// "working-hours" (uniform during WorkingHoursStartHour-WorkingHoursEndHour,
+	// slower outside it), or "composite" (a Poisson cadence with Gaussian
+	// noise layered on top). Empty is treated as "uniform".
+	BeaconProfile string
+
+	// GaussianStdDev is the standard deviation used by the "gaussian" and
+	// "composite" beacon profiles. Zero falls back to Jitter.
+	GaussianStdDev time.Duration
+
+	// PoissonLambda is the arrival rate (events/second) used by the
+	// "poisson" and "composite" beacon profiles. Zero falls back to a rate
+	// derived from BaseDelay.
+	PoissonLambda float64
+
+	// WorkingHoursStartHour and WorkingHoursEndHour bound the "working-hours"
+	// beacon profile's high-rate window, in 24-hour local time. Both zero
+	// falls back to 9-17.
+	WorkingHoursStartHour int
+	WorkingHoursEndHour   int
+
 	// ========== RESOLVER CONFIGURATION ==========
 	// ResolverType determines which resolver to use
 	ResolverType ResolverType
@@ -89,15 +113,90 @@ type AgentConfig struct {
 	// WARNING: Set to false in production
 	InsecureSkipVerify bool
 
+	// CAFile is the path to a CA certificate to trust for the encrypted modes
+	// (e.g. the server's auto-generated certs/ca.pem). Leave empty to use the
+	// system trust store, or set InsecureSkipVerify instead for quick testing.
+	CAFile string
+
+	// EnablePadding attaches RFC 7830 EDNS(0) padding to outgoing queries on
+	// the encrypted modes, so researchers can compare traffic with and
+	// without length-hiding padding. Has no effect on ModePlainDNS.
+	EnablePadding bool
+
 	// ========== DoH CONFIGURATION ==========
 	// DoHServerURL is the full URL to the DoH endpoint
 	// Example: "https://timeserversync.test:8443/dns-query"
 	DoHServerURL string
 
+	// DoHMethod selects how the DNS query is placed on the wire: "POST"
+	// (default, RFC 8484 §4.1 body) or "GET" (base64url in a ?dns= query
+	// parameter). Empty is treated as "POST".
+	DoHMethod string
+
+	// DoHPreferH3 races an HTTP/3 request against the HTTP/2 one and uses
+	// whichever answers first. Ignored if DoHForceH3 is also set.
+	DoHPreferH3 bool
+
+	// DoHForceH3 sends DoH queries only over HTTP/3, skipping HTTP/2
+	// entirely.
+	DoHForceH3 bool
+
 	// ========== DoT CONFIGURATION ==========
 	// DoTServerAddr is the address of the DoT server (IP:port)
 	// Example: "127.0.0.1:8853"
 	DoTServerAddr string
+
+	// DoTIdleTimeout is how long a pooled DoT connection is kept warm with
+	// no queries on it before it's closed. Zero uses DoTPoolOptions' default.
+	DoTIdleTimeout time.Duration
+
+	// DoTMaxInFlight is how many pipelined queries (RFC 7766) a single DoT
+	// connection carries before a new one is dialed. Zero uses
+	// DoTPoolOptions' default.
+	DoTMaxInFlight int
+
+	// DoTPinnedSPKISHA256, when set, constrains the DoT TLS handshake to
+	// accept only a server certificate whose SubjectPublicKeyInfo hashes
+	// (SHA-256) to this hex-encoded value, instead of relying solely on
+	// CAFile/the system trust store. Leave empty to disable pinning.
+	DoTPinnedSPKISHA256 string
+
+	// ========== DoQ CONFIGURATION ==========
+	// DoQServerAddr is the address of the DoQ server (IP:port)
+	// Example: "127.0.0.1:8484"
+	DoQServerAddr string
+
+	// DoQIdleTimeout is how long a pooled DoQ connection is kept warm with
+	// no queries on it before it's closed. Zero uses DoQPoolOptions' default.
+	DoQIdleTimeout time.Duration
+
+	// DoQMaxInFlight is how many concurrent streams a single DoQ connection
+	// carries before a new one is dialed. Zero uses DoQPoolOptions' default.
+	DoQMaxInFlight int
+
+	// ========== CONTROL PLANE CONFIGURATION ==========
+	// ControlPlaneAddr is the address of the server's control plane (see
+	// ServerConfig.ControlPlaneListen). Empty disables plan reporting:
+	// PlainDNSClientAdapter/DoTClient just send queries without pre-declaring them.
+	ControlPlaneAddr string
+
+	// AgentID identifies this agent to the control plane, so its reported
+	// plans and the server's observations can be attributed to it.
+	AgentID string
+
+	// ========== CLIENT-SIDE CACHE CONFIGURATION ==========
+	// EnableCache wraps the configured DNSClient in a modes.CachingClient,
+	// answering repeated queries locally when a live cache entry exists.
+	EnableCache bool
+
+	// CacheMaxEntries bounds the client-side LRU cache. Zero uses
+	// CachingClient's own default.
+	CacheMaxEntries int
+
+	// CacheNegativeTTL caps how long NXDOMAIN/NODATA responses are cached
+	// (RFC 2308's own SOA-derived TTL is used if it's shorter). Zero uses
+	// CachingClient's own default.
+	CacheNegativeTTL time.Duration
 }
 
 // ServerConfig holds all configuration for the DNS server
@@ -119,12 +218,69 @@ type ServerConfig struct {
 	EnableDoT      bool // TLS port 853
 	EnableDoQ      bool // QUIC port 853
 
+	// ========== LISTENER ADDRESSES ==========
+	// Addresses each enabled listener binds to (IP:port)
+	PlainDNSAddr string
+	DoHAddr      string
+	DoTAddr      string
+	DoQAddr      string
+
 	// ========== TLS CONFIGURATION ==========
 	// Paths to TLS certificate and key files
 	// Required for DoH, DoT, and DoQ
 	TLSCertFile string
 	TLSKeyFile  string
 
+	// ========== UPSTREAM CONFIGURATION ==========
+	// Upstream, when set, turns the server into a forwarding gateway: queries
+	// outside our zone are relayed to this upstream instead of NXDOMAIN'd.
+	// Leave nil to keep the authoritative-only behavior.
+	Upstream *UpstreamConfig
+
+	// Cache, when set, wraps the serving handler with a shared TTL-aware
+	// response cache. Leave nil to resolve every query fresh.
+	Cache *CacheConfig
+
+	// EnablePadding attaches RFC 7830 EDNS(0) padding to responses on the
+	// encrypted listeners (DoH/DoT/DoQ), so researchers can compare traffic
+	// with and without length-hiding padding. Plain DNS is never padded.
+	EnablePadding bool
+
+	// MetricsAddr is where the Prometheus /metrics endpoint listens.
+	// Leave empty to use metrics.DefaultAddr ("127.0.0.1:9153").
+	MetricsAddr string
+
+	// ========== DNSSEC CONFIGURATION ==========
+	// EnableDNSSEC signs A/NS/SOA answers and synthesizes NSEC/NSEC3 denial
+	// records on every listener, so DNSSEC-aware clients/resolvers have a
+	// real RRSIG/NSEC(3) chain to validate. Only applied to queries whose
+	// OPT record has the DO bit set; everyone else sees the plain response.
+	EnableDNSSEC bool
+
+	// ZoneKeyFile is where the zone's KSK+ZSK are stored, generated on
+	// first run if the file doesn't exist (see dns.EnsureZoneKey).
+	ZoneKeyFile string
+
+	// NSEC3Salt, when non-empty, switches negative-response denial
+	// synthesis from NSEC to NSEC3 (RFC 5155) using this hex-encoded salt.
+	// Leave empty for plain NSEC.
+	NSEC3Salt string
+
+	// ========== CONTROL PLANE CONFIGURATION ==========
+	// EnableControlPlane starts a small control plane server so agents can
+	// pre-declare the queries they're about to send (see AgentConfig's
+	// ControlPlaneAddr/AgentID) and this server can join those plans
+	// against what it actually observes.
+	EnableControlPlane bool
+
+	// ControlPlaneListen is the address the control plane server binds to.
+	ControlPlaneListen string
+
+	// ControlReportFile is where the planned-vs-observed joined report is
+	// appended as JSONL, one line per planned query as it's matched (or at
+	// session end, if it never was). Created if it doesn't exist.
+	ControlReportFile string
+
 	// ========== LOGGING ==========
 	// LogQueries enables detailed query logging
 	LogQueries bool
@@ -169,6 +325,20 @@ func (c *AgentConfig) Validate() error {
 		}
 	}
 
+	// Check DoH method
+	switch strings.ToUpper(c.DoHMethod) {
+	case "", "POST", "GET":
+	default:
+		return fmt.Errorf("DoH method must be POST or GET, got %q", c.DoHMethod)
+	}
+
+	// Check beacon profile
+	switch strings.ToLower(c.BeaconProfile) {
+	case "", "uniform", "gaussian", "poisson", "working-hours", "composite":
+	default:
+		return fmt.Errorf("beacon profile must be uniform, gaussian, poisson, working-hours, or composite, got %q", c.BeaconProfile)
+	}
+
 	return nil
 }
 
@@ -196,6 +366,14 @@ func (c *ServerConfig) Validate() error {
 		}
 	}
 
+	if c.EnableDNSSEC && c.ZoneKeyFile == "" {
+		return fmt.Errorf("zone key file required when DNSSEC is enabled")
+	}
+
+	if c.EnableControlPlane && c.ControlPlaneListen == "" {
+		return fmt.Errorf("control plane listen address required when the control plane is enabled")
+	}
+
 	return nil
 }
 
@@ -215,22 +393,35 @@ func DefaultAgentConfig() *AgentConfig {
 		InsecureSkipVerify: false, // Require valid certs
 		DoHServerURL:       "https://127.0.0.1:8443/dns-query",
 		DoTServerAddr:      "127.0.0.1:8853",
+		ControlPlaneAddr:   "",
+		AgentID:            "",
 	}
 }
 
 // DefaultServerConfig returns a sensible default configuration
 func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
-		Domain:         "timeserversync.com",
-		ResponseIP:     "1.2.3.4", // Dummy IP
-		TTL:            60,        // 60 second TTL
-		EnablePlainDNS: true,      // Enable all modes by default
-		EnableDoH:      true,
-		EnableDoT:      true,
-		EnableDoQ:      false, // DoQ might not be fully implemented
-		TLSCertFile:    "/etc/letsencrypt/live/timeserversync.com/fullchain.pem",
-		TLSKeyFile:     "/etc/letsencrypt/live/timeserversync.com/privkey.pem",
-		LogQueries:     true,
-		Verbose:        false,
+		Domain:             "timeserversync.com",
+		ResponseIP:         "1.2.3.4", // Dummy IP
+		TTL:                60,        // 60 second TTL
+		EnablePlainDNS:     true,      // Enable all modes by default
+		EnableDoH:          true,
+		EnableDoT:          true,
+		EnableDoQ:          false, // DoQ listener off unless enabled explicitly
+		PlainDNSAddr:       "127.0.0.1:15353",
+		DoHAddr:            "127.0.0.1:8443",
+		DoTAddr:            "127.0.0.1:8853",
+		DoQAddr:            "127.0.0.1:8484",
+		TLSCertFile:        "/etc/letsencrypt/live/timeserversync.com/fullchain.pem",
+		TLSKeyFile:         "/etc/letsencrypt/live/timeserversync.com/privkey.pem",
+		MetricsAddr:        "",
+		EnableDNSSEC:       false,
+		ZoneKeyFile:        "./certs/zone.key",
+		NSEC3Salt:          "",
+		EnableControlPlane: false,
+		ControlPlaneListen: "127.0.0.1:9090",
+		ControlReportFile:  "./control-report.jsonl",
+		LogQueries:         true,
+		Verbose:            false,
 	}
 }
@@ -0,0 +1,401 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolateEnv expands ${VAR} references against the process environment.
+// A reference to an unset variable is left untouched (rather than blanked to
+// an empty string) so a misconfigured container shows up as a literal
+// "${VAR}" in the resolved config instead of silently disappearing.
+func interpolateEnv(raw string) string {
+	return os.Expand(raw, func(key string) string {
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+		return "${" + key + "}"
+	})
+}
+
+// yamlUpstreamConfig mirrors UpstreamConfig with a YAML-friendly (seconds)
+// representation of the timeout
+type yamlUpstreamConfig struct {
+	Address            string `yaml:"address"`
+	BootstrapResolver  string `yaml:"bootstrap_resolver"`
+	TimeoutSeconds     int    `yaml:"timeout_seconds"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// yamlCacheConfig mirrors CacheConfig with a YAML-friendly (seconds)
+// representation of the negative TTL
+type yamlCacheConfig struct {
+	MaxEntries         int `yaml:"max_entries"`
+	NegativeTTLSeconds int `yaml:"negative_ttl_seconds"`
+}
+
+// yamlServerConfig is the on-disk shape of a server config file. Pointer
+// fields distinguish "not set" from the Go zero value, so a YAML file only
+// needs to mention the settings it wants to override; everything else keeps
+// DefaultServerConfig's value.
+type yamlServerConfig struct {
+	Domain         string              `yaml:"domain"`
+	ResponseIP     string              `yaml:"response_ip"`
+	TTL            uint32              `yaml:"ttl"`
+	EnablePlainDNS *bool               `yaml:"enable_plain_dns"`
+	EnableDoH      *bool               `yaml:"enable_doh"`
+	EnableDoT      *bool               `yaml:"enable_dot"`
+	EnableDoQ      *bool               `yaml:"enable_doq"`
+	PlainDNSAddr   string              `yaml:"plain_dns_addr"`
+	DoHAddr        string              `yaml:"doh_addr"`
+	DoTAddr        string              `yaml:"dot_addr"`
+	DoQAddr        string              `yaml:"doq_addr"`
+	TLSCertFile    string              `yaml:"tls_cert_file"`
+	TLSKeyFile     string              `yaml:"tls_key_file"`
+	Upstream       *yamlUpstreamConfig `yaml:"upstream"`
+	Cache          *yamlCacheConfig    `yaml:"cache"`
+	EnablePadding  *bool               `yaml:"enable_padding"`
+	MetricsAddr    string              `yaml:"metrics_addr"`
+	EnableDNSSEC   *bool               `yaml:"enable_dnssec"`
+	ZoneKeyFile    string              `yaml:"zone_key_file"`
+	NSEC3Salt      string              `yaml:"nsec3_salt"`
+
+	EnableControlPlane *bool  `yaml:"enable_control_plane"`
+	ControlPlaneListen string `yaml:"control_plane_listen"`
+	ControlReportFile  string `yaml:"control_report_file"`
+
+	LogQueries *bool `yaml:"log_queries"`
+	Verbose    *bool `yaml:"verbose"`
+}
+
+// LoadServerConfig reads a YAML server config from path, expanding ${VAR}
+// environment references first. Fields absent from the file fall back to
+// DefaultServerConfig's values. An empty path returns the defaults unchanged.
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	cfg := DefaultServerConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server config %s: %w", path, err)
+	}
+
+	var y yamlServerConfig
+	if err := yaml.Unmarshal([]byte(interpolateEnv(string(raw))), &y); err != nil {
+		return nil, fmt.Errorf("failed to parse server config %s: %w", path, err)
+	}
+
+	applyServerYAML(cfg, &y)
+	return cfg, nil
+}
+
+func applyServerYAML(cfg *ServerConfig, y *yamlServerConfig) {
+	if y.Domain != "" {
+		cfg.Domain = y.Domain
+	}
+	if y.ResponseIP != "" {
+		cfg.ResponseIP = y.ResponseIP
+	}
+	if y.TTL != 0 {
+		cfg.TTL = y.TTL
+	}
+	if y.EnablePlainDNS != nil {
+		cfg.EnablePlainDNS = *y.EnablePlainDNS
+	}
+	if y.EnableDoH != nil {
+		cfg.EnableDoH = *y.EnableDoH
+	}
+	if y.EnableDoT != nil {
+		cfg.EnableDoT = *y.EnableDoT
+	}
+	if y.EnableDoQ != nil {
+		cfg.EnableDoQ = *y.EnableDoQ
+	}
+	if y.PlainDNSAddr != "" {
+		cfg.PlainDNSAddr = y.PlainDNSAddr
+	}
+	if y.DoHAddr != "" {
+		cfg.DoHAddr = y.DoHAddr
+	}
+	if y.DoTAddr != "" {
+		cfg.DoTAddr = y.DoTAddr
+	}
+	if y.DoQAddr != "" {
+		cfg.DoQAddr = y.DoQAddr
+	}
+	if y.TLSCertFile != "" {
+		cfg.TLSCertFile = y.TLSCertFile
+	}
+	if y.TLSKeyFile != "" {
+		cfg.TLSKeyFile = y.TLSKeyFile
+	}
+	if y.Upstream != nil {
+		cfg.Upstream = &UpstreamConfig{
+			Address:            y.Upstream.Address,
+			BootstrapResolver:  y.Upstream.BootstrapResolver,
+			Timeout:            y.Upstream.TimeoutSeconds,
+			InsecureSkipVerify: y.Upstream.InsecureSkipVerify,
+		}
+	}
+	if y.Cache != nil {
+		cfg.Cache = &CacheConfig{
+			MaxEntries:  y.Cache.MaxEntries,
+			NegativeTTL: time.Duration(y.Cache.NegativeTTLSeconds) * time.Second,
+		}
+	}
+	if y.EnablePadding != nil {
+		cfg.EnablePadding = *y.EnablePadding
+	}
+	if y.MetricsAddr != "" {
+		cfg.MetricsAddr = y.MetricsAddr
+	}
+	if y.EnableDNSSEC != nil {
+		cfg.EnableDNSSEC = *y.EnableDNSSEC
+	}
+	if y.ZoneKeyFile != "" {
+		cfg.ZoneKeyFile = y.ZoneKeyFile
+	}
+	if y.NSEC3Salt != "" {
+		cfg.NSEC3Salt = y.NSEC3Salt
+	}
+	if y.EnableControlPlane != nil {
+		cfg.EnableControlPlane = *y.EnableControlPlane
+	}
+	if y.ControlPlaneListen != "" {
+		cfg.ControlPlaneListen = y.ControlPlaneListen
+	}
+	if y.ControlReportFile != "" {
+		cfg.ControlReportFile = y.ControlReportFile
+	}
+	if y.LogQueries != nil {
+		cfg.LogQueries = *y.LogQueries
+	}
+	if y.Verbose != nil {
+		cfg.Verbose = *y.Verbose
+	}
+}
+
+// yamlAgentConfig is the on-disk shape of an agent config file, analogous to
+// yamlServerConfig
+type yamlAgentConfig struct {
+	Mode                    string  `yaml:"mode"`
+	BaseDelaySeconds        float64 `yaml:"base_delay_seconds"`
+	JitterSeconds           float64 `yaml:"jitter_seconds"`
+	BeaconProfile           string  `yaml:"beacon_profile"`
+	GaussianStdDevSeconds   float64 `yaml:"gaussian_stddev_seconds"`
+	PoissonLambda           float64 `yaml:"poisson_lambda"`
+	WorkingHoursStartHour   int     `yaml:"working_hours_start_hour"`
+	WorkingHoursEndHour     int     `yaml:"working_hours_end_hour"`
+	ResolverType            string  `yaml:"resolver_type"`
+	ResolverAddress         string  `yaml:"resolver_address"`
+	TargetDomain            string  `yaml:"target_domain"`
+	SubdomainMinLength      int     `yaml:"subdomain_min_length"`
+	SubdomainMaxLength      int     `yaml:"subdomain_max_length"`
+	TLSServerName           string  `yaml:"tls_server_name"`
+	InsecureSkipVerify      *bool   `yaml:"insecure_skip_verify"`
+	CAFile                  string  `yaml:"ca_file"`
+	EnablePadding           *bool   `yaml:"enable_padding"`
+	DoHServerURL            string  `yaml:"doh_server_url"`
+	DoHMethod               string  `yaml:"doh_method"`
+	DoHPreferH3             *bool   `yaml:"doh_prefer_h3"`
+	DoHForceH3              *bool   `yaml:"doh_force_h3"`
+	DoTServerAddr           string  `yaml:"dot_server_addr"`
+	DoTIdleTimeoutSeconds   int     `yaml:"dot_idle_timeout_seconds"`
+	DoTMaxInFlight          int     `yaml:"dot_max_in_flight"`
+	DoTPinnedSPKISHA256     string  `yaml:"dot_pinned_spki_sha256"`
+	DoQServerAddr           string  `yaml:"doq_server_addr"`
+	DoQIdleTimeoutSeconds   int     `yaml:"doq_idle_timeout_seconds"`
+	DoQMaxInFlight          int     `yaml:"doq_max_in_flight"`
+	ControlPlaneAddr        string  `yaml:"control_plane_addr"`
+	AgentID                 string  `yaml:"agent_id"`
+	EnableCache             *bool   `yaml:"enable_cache"`
+	CacheMaxEntries         int     `yaml:"cache_max_entries"`
+	CacheNegativeTTLSeconds int     `yaml:"cache_negative_ttl_seconds"`
+}
+
+// LoadAgentConfig reads a YAML agent config from path, expanding ${VAR}
+// environment references first. Fields absent from the file fall back to
+// DefaultAgentConfig's values. An empty path returns the defaults unchanged.
+func LoadAgentConfig(path string) (*AgentConfig, error) {
+	cfg := DefaultAgentConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent config %s: %w", path, err)
+	}
+
+	var y yamlAgentConfig
+	if err := yaml.Unmarshal([]byte(interpolateEnv(string(raw))), &y); err != nil {
+		return nil, fmt.Errorf("failed to parse agent config %s: %w", path, err)
+	}
+
+	if err := applyAgentYAML(cfg, &y); err != nil {
+		return nil, fmt.Errorf("invalid agent config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func applyAgentYAML(cfg *AgentConfig, y *yamlAgentConfig) error {
+	if y.Mode != "" {
+		mode, err := ParseOperationMode(y.Mode)
+		if err != nil {
+			return err
+		}
+		cfg.Mode = mode
+	}
+	if y.BaseDelaySeconds != 0 {
+		cfg.BaseDelay = time.Duration(y.BaseDelaySeconds * float64(time.Second))
+	}
+	if y.JitterSeconds != 0 {
+		cfg.Jitter = time.Duration(y.JitterSeconds * float64(time.Second))
+	}
+	if y.BeaconProfile != "" {
+		cfg.BeaconProfile = y.BeaconProfile
+	}
+	if y.GaussianStdDevSeconds != 0 {
+		cfg.GaussianStdDev = time.Duration(y.GaussianStdDevSeconds * float64(time.Second))
+	}
+	if y.PoissonLambda != 0 {
+		cfg.PoissonLambda = y.PoissonLambda
+	}
+	if y.WorkingHoursStartHour != 0 {
+		cfg.WorkingHoursStartHour = y.WorkingHoursStartHour
+	}
+	if y.WorkingHoursEndHour != 0 {
+		cfg.WorkingHoursEndHour = y.WorkingHoursEndHour
+	}
+	if y.ResolverType != "" {
+		resolverType, err := ParseResolverType(y.ResolverType)
+		if err != nil {
+			return err
+		}
+		cfg.ResolverType = resolverType
+	}
+	if y.ResolverAddress != "" {
+		cfg.ResolverAddress = y.ResolverAddress
+	}
+	if y.TargetDomain != "" {
+		cfg.TargetDomain = y.TargetDomain
+	}
+	if y.SubdomainMinLength != 0 {
+		cfg.SubdomainMinLength = y.SubdomainMinLength
+	}
+	if y.SubdomainMaxLength != 0 {
+		cfg.SubdomainMaxLength = y.SubdomainMaxLength
+	}
+	if y.TLSServerName != "" {
+		cfg.TLSServerName = y.TLSServerName
+	}
+	if y.InsecureSkipVerify != nil {
+		cfg.InsecureSkipVerify = *y.InsecureSkipVerify
+	}
+	if y.CAFile != "" {
+		cfg.CAFile = y.CAFile
+	}
+	if y.EnablePadding != nil {
+		cfg.EnablePadding = *y.EnablePadding
+	}
+	if y.DoHServerURL != "" {
+		cfg.DoHServerURL = y.DoHServerURL
+	}
+	if y.DoHMethod != "" {
+		cfg.DoHMethod = y.DoHMethod
+	}
+	if y.DoHPreferH3 != nil {
+		cfg.DoHPreferH3 = *y.DoHPreferH3
+	}
+	if y.DoHForceH3 != nil {
+		cfg.DoHForceH3 = *y.DoHForceH3
+	}
+	if y.DoTServerAddr != "" {
+		cfg.DoTServerAddr = y.DoTServerAddr
+	}
+	if y.DoTIdleTimeoutSeconds != 0 {
+		cfg.DoTIdleTimeout = time.Duration(y.DoTIdleTimeoutSeconds) * time.Second
+	}
+	if y.DoTMaxInFlight != 0 {
+		cfg.DoTMaxInFlight = y.DoTMaxInFlight
+	}
+	if y.DoTPinnedSPKISHA256 != "" {
+		cfg.DoTPinnedSPKISHA256 = y.DoTPinnedSPKISHA256
+	}
+	if y.DoQServerAddr != "" {
+		cfg.DoQServerAddr = y.DoQServerAddr
+	}
+	if y.DoQIdleTimeoutSeconds != 0 {
+		cfg.DoQIdleTimeout = time.Duration(y.DoQIdleTimeoutSeconds) * time.Second
+	}
+	if y.DoQMaxInFlight != 0 {
+		cfg.DoQMaxInFlight = y.DoQMaxInFlight
+	}
+	if y.ControlPlaneAddr != "" {
+		cfg.ControlPlaneAddr = y.ControlPlaneAddr
+	}
+	if y.AgentID != "" {
+		cfg.AgentID = y.AgentID
+	}
+	if y.EnableCache != nil {
+		cfg.EnableCache = *y.EnableCache
+	}
+	if y.CacheMaxEntries != 0 {
+		cfg.CacheMaxEntries = y.CacheMaxEntries
+	}
+	if y.CacheNegativeTTLSeconds != 0 {
+		cfg.CacheNegativeTTL = time.Duration(y.CacheNegativeTTLSeconds) * time.Second
+	}
+	return nil
+}
+
+// ParseOperationMode maps a config/CLI mode name ("plain", "doh", "dot",
+// "doq") to its OperationMode constant
+func ParseOperationMode(name string) (OperationMode, error) {
+	switch strings.ToLower(name) {
+	case "plain", "plaindns":
+		return ModePlainDNS, nil
+	case "doh":
+		return ModeDoH, nil
+	case "dot":
+		return ModeDoT, nil
+	case "doq":
+		return ModeDoQ, nil
+	default:
+		return 0, fmt.Errorf("unknown mode %q: expected plain, doh, dot, or doq", name)
+	}
+}
+
+// WithPort returns addr with its port replaced by port, keeping the existing
+// host (or falling back to 127.0.0.1 if addr can't be parsed). Used to apply
+// CLI flags like --doq-port without requiring the full address to be given.
+func WithPort(addr string, port int) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// ParseResolverType maps a config/CLI resolver type name ("local", "public",
+// "authoritative") to its ResolverType constant
+func ParseResolverType(name string) (ResolverType, error) {
+	switch strings.ToLower(name) {
+	case "local":
+		return ResolverLocal, nil
+	case "public":
+		return ResolverPublic, nil
+	case "authoritative":
+		return ResolverAuthoritative, nil
+	default:
+		return 0, fmt.Errorf("unknown resolver type %q: expected local, public, or authoritative", name)
+	}
+}
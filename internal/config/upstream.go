@@ -0,0 +1,24 @@
+package config
+
+// UpstreamConfig describes an upstream resolver the server forwards
+// out-of-zone queries to, following the dnsproxy-style address convention:
+//
+//	udp://1.1.1.1:53              - Plain DNS
+//	tls://1.1.1.1:853             - DNS-over-TLS
+//	https://dns.google/dns-query  - DNS-over-HTTPS
+//	quic://dns.adguard.com:853    - DNS-over-QUIC
+type UpstreamConfig struct {
+	// Address is the upstream in AddressToUpstream form (see the scheme table above)
+	Address string
+
+	// BootstrapResolver resolves the upstream's hostname (for any upstream whose
+	// host isn't given as a bare IP). It is never the system resolver, so DNS
+	// resolution for the upstream itself doesn't leak outside the simulator.
+	BootstrapResolver string
+
+	// Timeout bounds how long we wait for the upstream to answer
+	Timeout int // seconds
+
+	// InsecureSkipVerify allows self-signed certs on tls/https/quic upstreams
+	InsecureSkipVerify bool
+}
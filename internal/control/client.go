@@ -0,0 +1,101 @@
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client is the agent-side counterpart to Server: it pre-declares query
+// plans to a control plane server and fetches what the authoritative
+// responder expects to answer for them.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a Client targeting a control plane server at addr
+// (host:port, as configured via AgentConfig.ControlPlaneAddr).
+func NewClient(addr string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Client{
+		baseURL: "http://" + addr,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// RegisterAgent announces agentID to the control plane.
+func (c *Client) RegisterAgent(agentID string) error {
+	_, err := c.post("/register-agent", map[string]string{"agent_id": agentID}, nil)
+	return err
+}
+
+// ReportQueryPlan pre-declares plan to the control plane, before (or as) the
+// agent actually sends the queries it describes.
+func (c *Client) ReportQueryPlan(plan QueryPlan) error {
+	_, err := c.post("/report-query-plan", plan, nil)
+	return err
+}
+
+// ReportQuery is a convenience around ReportQueryPlan for callers that
+// pre-declare one query at a time, like PlainDNSClientAdapter/DoTClient's
+// Query hooks, rather than an agent that plans a whole burst upfront. It
+// generates its own SessionID from agentID and the current time.
+func (c *Client) ReportQuery(agentID, fqdn, transport string) error {
+	now := time.Now()
+	return c.ReportQueryPlan(QueryPlan{
+		AgentID:   agentID,
+		SessionID: fmt.Sprintf("%s-%d", agentID, now.UnixNano()),
+		Queries:   []PlannedQuery{{FQDN: fqdn, Transport: transport, PlannedAt: now}},
+	})
+}
+
+// FetchExpectedResponses retrieves what the authoritative responder expects
+// to answer for the FQDNs planned under sessionID.
+func (c *Client) FetchExpectedResponses(sessionID string) ([]ExpectedResponse, error) {
+	resp, err := c.http.Get(c.baseURL + "/expected-responses?session_id=" + url.QueryEscape(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("control plane request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("control plane returned HTTP %d", resp.StatusCode)
+	}
+
+	var expected []ExpectedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&expected); err != nil {
+		return nil, fmt.Errorf("failed to decode expected responses: %w", err)
+	}
+	return expected, nil
+}
+
+// post sends body as JSON to path and decodes the response into out, if out
+// is non-nil.
+func (c *Client) post(path string, body interface{}, out interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.http.Post(c.baseURL+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("control plane request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp, fmt.Errorf("control plane returned HTTP %d", resp.StatusCode)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,262 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hub holds the control plane's in-memory ground-truth state: registered
+// agents and the query plans they've reported, joined against observed
+// queries as they arrive and emitted as one JSONL line per planned query.
+//
+// This is deliberately simple (no persistence, no multi-process fan-out):
+// it exists to let a single research run compute detection false
+// negative/positive rates without correlating logs across two machines by
+// hand, not to be a production telemetry pipeline.
+type Hub struct {
+	domain     string
+	responseIP string
+
+	report io.Writer
+
+	mu     sync.Mutex
+	agents map[string]AgentRegistration
+	plans  map[string]*trackedPlan
+}
+
+// staleSessionTimeout is how long a tracked session can go without every
+// entry being matched before Observe finalizes it as missed on its own,
+// the same as an explicit FinalizeSession call. Without this, a query that
+// never reaches the server (blocked, dropped) would sit in Hub.plans
+// forever, since nothing else would ever call FinalizeSession for it.
+const staleSessionTimeout = 5 * time.Minute
+
+// trackedPlan is a QueryPlan plus which of its entries (by index) have
+// already been matched to an observed query.
+type trackedPlan struct {
+	plan    QueryPlan
+	matched map[int]time.Time
+}
+
+// NewHub creates a Hub. report receives one JoinedReport JSONL line per
+// planned query as it's matched against an observed one (or left unmatched
+// at FinalizeSession). domain/responseIP mirror the authoritative Server's
+// configuration, so FetchExpectedResponses can compute the same synthetic
+// answers it would.
+func NewHub(report io.Writer, domain, responseIP string) *Hub {
+	return &Hub{
+		domain:     domain,
+		responseIP: responseIP,
+		report:     report,
+		agents:     make(map[string]AgentRegistration),
+		plans:      make(map[string]*trackedPlan),
+	}
+}
+
+// RegisterAgent records that agentID is about to start reporting plans.
+func (h *Hub) RegisterAgent(agentID string) AgentRegistration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	reg := AgentRegistration{AgentID: agentID, RegisteredAt: time.Now()}
+	h.agents[agentID] = reg
+	return reg
+}
+
+// ReportQueryPlan appends plan's queries onto the tracked plan for its
+// SessionID, creating one if this is the first report for that session.
+// Appending (rather than replacing) lets an agent call this once per burst
+// or once per query, as PlainDNSClientAdapter/DoTClient's hooks do, without losing
+// earlier entries' match state.
+func (h *Hub) ReportQueryPlan(plan QueryPlan) error {
+	if plan.SessionID == "" {
+		return fmt.Errorf("query plan missing session ID")
+	}
+	if len(plan.Queries) == 0 {
+		return fmt.Errorf("query plan has no queries")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tracked, ok := h.plans[plan.SessionID]
+	if !ok {
+		tracked = &trackedPlan{
+			plan:    QueryPlan{AgentID: plan.AgentID, SessionID: plan.SessionID},
+			matched: make(map[int]time.Time),
+		}
+		h.plans[plan.SessionID] = tracked
+	}
+	tracked.plan.Queries = append(tracked.plan.Queries, plan.Queries...)
+
+	return nil
+}
+
+// FetchExpectedResponses returns what the authoritative responder will
+// answer for each FQDN planned under sessionID, computed the same way
+// Server.handleQuestion does for TypeA queries (the only type this
+// subsystem's planned queries carry).
+func (h *Hub) FetchExpectedResponses(sessionID string) ([]ExpectedResponse, error) {
+	h.mu.Lock()
+	tracked, ok := h.plans[sessionID]
+	h.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown session %q", sessionID)
+	}
+
+	expected := make([]ExpectedResponse, 0, len(tracked.plan.Queries))
+	for _, q := range tracked.plan.Queries {
+		resp := ExpectedResponse{FQDN: q.FQDN}
+		if isSubdomainOf(q.FQDN, h.domain) {
+			resp.ResponseIP = h.responseIP
+			resp.Rcode = 0 // dns.RcodeSuccess
+		} else {
+			resp.Rcode = 3 // dns.RcodeNameError
+		}
+		expected = append(expected, resp)
+	}
+	return expected, nil
+}
+
+// isSubdomainOf is a dependency-free stand-in for dns.IsSubDomain, so this
+// package doesn't need to import miekg/dns just to answer
+// FetchExpectedResponses.
+func isSubdomainOf(name, domain string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	domain = strings.ToLower(strings.TrimSuffix(domain, ".")) + "."
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// Observe records that fqdn actually arrived over transport, matching it
+// against the oldest unmatched planned entry for that FQDN across every
+// tracked session and writing a joined report line immediately. A session
+// whose every entry has now been matched is dropped from memory, the same
+// as if FinalizeSession had been called on it.
+func (h *Hub) Observe(fqdn, transport string) {
+	observedAt := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sweepStaleLocked(observedAt)
+
+	var bestSession string
+	var bestIndex int
+	var bestPlannedAt time.Time
+	found := false
+
+	for sessionID, tracked := range h.plans {
+		for i, q := range tracked.plan.Queries {
+			if _, already := tracked.matched[i]; already {
+				continue
+			}
+			if !strings.EqualFold(q.FQDN, fqdn) {
+				continue
+			}
+			if !found || q.PlannedAt.Before(bestPlannedAt) {
+				bestSession, bestIndex, bestPlannedAt, found = sessionID, i, q.PlannedAt, true
+			}
+		}
+	}
+
+	if !found {
+		// Not part of any tracked plan: still worth recording, so a
+		// researcher can spot queries the agent never declared (a false
+		// negative in the agent's own reporting, or traffic from something
+		// else entirely).
+		h.writeReport(JoinedReport{FQDN: fqdn, Transport: transport, ObservedAt: &observedAt, Matched: false})
+		return
+	}
+
+	tracked := h.plans[bestSession]
+	tracked.matched[bestIndex] = observedAt
+	plannedAt := bestPlannedAt
+	h.writeReport(JoinedReport{
+		SessionID:  tracked.plan.SessionID,
+		AgentID:    tracked.plan.AgentID,
+		FQDN:       fqdn,
+		Transport:  transport,
+		PlannedAt:  &plannedAt,
+		ObservedAt: &observedAt,
+		Matched:    true,
+	})
+
+	if len(tracked.matched) == len(tracked.plan.Queries) {
+		delete(h.plans, bestSession)
+	}
+}
+
+// FinalizeSession emits a "missed" joined report line for every planned
+// entry in sessionID that never got matched by an observed query, then
+// drops the session from memory. Call this once an agent's burst is done.
+func (h *Hub) FinalizeSession(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.plans[sessionID]; !ok {
+		return
+	}
+	h.finalizeLocked(sessionID)
+}
+
+// sweepStaleLocked finalizes every tracked session whose oldest entry was
+// planned more than staleSessionTimeout before now, so a query that never
+// reaches the server (blocked, dropped, agent crashed before sending it)
+// still gets a "missed" report line and doesn't sit in h.plans forever.
+// Caller must hold h.mu. Piggybacked on Observe rather than run on a timer,
+// the same way ResponseCache ages out entries lazily on Get.
+func (h *Hub) sweepStaleLocked(now time.Time) {
+	for sessionID, tracked := range h.plans {
+		if len(tracked.plan.Queries) == 0 {
+			// Shouldn't happen — ReportQueryPlan rejects empty plans — but
+			// skip defensively rather than index a slice that might be.
+			continue
+		}
+		oldest := tracked.plan.Queries[0].PlannedAt
+		for _, q := range tracked.plan.Queries[1:] {
+			if q.PlannedAt.Before(oldest) {
+				oldest = q.PlannedAt
+			}
+		}
+		if now.Sub(oldest) > staleSessionTimeout {
+			h.finalizeLocked(sessionID)
+		}
+	}
+}
+
+// finalizeLocked is FinalizeSession's body, shared with sweepStaleLocked.
+// Caller must hold h.mu and have already confirmed sessionID is tracked.
+func (h *Hub) finalizeLocked(sessionID string) {
+	tracked := h.plans[sessionID]
+
+	for i, q := range tracked.plan.Queries {
+		if _, matched := tracked.matched[i]; matched {
+			continue
+		}
+		plannedAt := q.PlannedAt
+		h.writeReport(JoinedReport{
+			SessionID: tracked.plan.SessionID,
+			AgentID:   tracked.plan.AgentID,
+			FQDN:      q.FQDN,
+			Transport: q.Transport,
+			PlannedAt: &plannedAt,
+			Matched:   false,
+		})
+	}
+
+	delete(h.plans, sessionID)
+}
+
+// writeReport appends one JSONL line to the report writer. Caller must hold h.mu.
+func (h *Hub) writeReport(r JoinedReport) {
+	if h.report == nil {
+		return
+	}
+	if err := json.NewEncoder(h.report).Encode(r); err != nil {
+		fmt.Printf("[control] failed to write joined report line: %v\n", err)
+	}
+}
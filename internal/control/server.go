@@ -0,0 +1,101 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Server exposes a Hub over a small HTTP/JSON transport: RegisterAgent,
+// ReportQueryPlan, and FetchExpectedResponses, one endpoint each. The
+// control plane was originally specified as gRPC, but this tree has no
+// protoc/grpc-go toolchain available to generate real stubs, so these three
+// operations are implemented directly over HTTP/JSON instead; Client is the
+// matching agent-side transport.
+type Server struct {
+	hub        *Hub
+	address    string
+	httpServer *http.Server
+}
+
+// NewServer creates a control plane server bound to address, backed by hub.
+func NewServer(hub *Hub, address string) *Server {
+	return &Server{hub: hub, address: address}
+}
+
+// Start begins serving the control plane endpoints. This blocks until the
+// server stops.
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register-agent", s.handleRegisterAgent)
+	mux.HandleFunc("/report-query-plan", s.handleReportQueryPlan)
+	mux.HandleFunc("/expected-responses", s.handleFetchExpectedResponses)
+
+	s.httpServer = &http.Server{
+		Addr:    s.address,
+		Handler: mux,
+	}
+
+	fmt.Printf("Starting control plane server on %s\n", s.address)
+
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to start control plane server: %w", err)
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the control plane server
+func (s *Server) Stop() error {
+	if s.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.httpServer.Shutdown(ctx)
+	}
+	return nil
+}
+
+func (s *Server) handleRegisterAgent(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, s.hub.RegisterAgent(req.AgentID))
+}
+
+func (s *Server) handleReportQueryPlan(w http.ResponseWriter, r *http.Request) {
+	var plan QueryPlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.hub.ReportQueryPlan(plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleFetchExpectedResponses(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+
+	expected, err := s.hub.FetchExpectedResponses(sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, expected)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("[control] failed to write JSON response: %v\n", err)
+	}
+}
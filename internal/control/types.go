@@ -0,0 +1,49 @@
+package control
+
+import "time"
+
+// AgentRegistration records an agent that has announced itself to the
+// control plane via RegisterAgent.
+type AgentRegistration struct {
+	AgentID      string    `json:"agent_id"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// PlannedQuery is one FQDN an agent intends to send, pre-declared before it
+// actually sends it.
+type PlannedQuery struct {
+	FQDN      string    `json:"fqdn"`
+	Transport string    `json:"transport"` // "plain", "doh", "dot", "doq"
+	PlannedAt time.Time `json:"planned_at"`
+}
+
+// QueryPlan is a batch of PlannedQuerys an agent reports via ReportQueryPlan,
+// identified by SessionID so FetchExpectedResponses and the eventual joined
+// report can correlate them back to the same burst.
+type QueryPlan struct {
+	AgentID   string         `json:"agent_id"`
+	SessionID string         `json:"session_id"`
+	Queries   []PlannedQuery `json:"queries"`
+}
+
+// ExpectedResponse is what the authoritative responder will answer for one
+// planned FQDN, computed the same way Server.handleQuestion does for a
+// TypeA query.
+type ExpectedResponse struct {
+	FQDN       string `json:"fqdn"`
+	ResponseIP string `json:"response_ip,omitempty"`
+	Rcode      int    `json:"rcode"`
+}
+
+// JoinedReport is one line of the planned-vs-observed JSONL report: a
+// planned query matched against whether (and when) it actually arrived, or
+// an observed query that matched no known plan.
+type JoinedReport struct {
+	SessionID  string     `json:"session_id,omitempty"`
+	AgentID    string     `json:"agent_id,omitempty"`
+	FQDN       string     `json:"fqdn"`
+	Transport  string     `json:"transport"`
+	PlannedAt  *time.Time `json:"planned_at,omitempty"`
+	ObservedAt *time.Time `json:"observed_at,omitempty"`
+	Matched    bool       `json:"matched"`
+}
@@ -2,30 +2,40 @@ package dns
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
-	"math/big"
 	"time"
+
+	"github.com/faanross/dns-encryption-simulator/internal/modes"
+	"github.com/faanross/dns-encryption-simulator/internal/timing"
 )
 
 // Beacon represents a DNS beaconing client
 // This simulates malware C2 behavior with periodic DNS queries
 type Beacon struct {
-	client    *PlainDNSClient
+	client    modes.DNSClient
 	generator *SubdomainGenerator
 	domain    string
-	baseDelay time.Duration
-	jitter    time.Duration
+	scheduler timing.Scheduler
+}
+
+// NewBeacon creates a new DNS beacon using a UniformJitter schedule
+// (baseDelay ± jitter), the simulator's original fixed-cadence behavior.
+// client can be any modes.DNSClient (plain, DoH, DoT, DoQ, or a decorator
+// like modes.CachingClient/modes.RacingClient), so the beacon is no longer
+// tied to plain UDP queries.
+func NewBeacon(client modes.DNSClient, generator *SubdomainGenerator, domain string, baseDelay, jitter time.Duration) *Beacon {
+	return NewBeaconWithScheduler(client, generator, domain, timing.NewUniformJitter(baseDelay, jitter))
 }
 
-// NewBeacon creates a new DNS beacon
-func NewBeacon(client *PlainDNSClient, generator *SubdomainGenerator, domain string, baseDelay, jitter time.Duration) *Beacon {
+// NewBeaconWithScheduler creates a new DNS beacon driven by an arbitrary
+// timing.Scheduler, e.g. a PoissonBeacon or WorkingHours profile instead of
+// the default fixed-cadence jitter.
+func NewBeaconWithScheduler(client modes.DNSClient, generator *SubdomainGenerator, domain string, scheduler timing.Scheduler) *Beacon {
 	return &Beacon{
 		client:    client,
 		generator: generator,
 		domain:    domain,
-		baseDelay: baseDelay,
-		jitter:    jitter,
+		scheduler: scheduler,
 	}
 }
 
@@ -33,7 +43,6 @@ func NewBeacon(client *PlainDNSClient, generator *SubdomainGenerator, domain str
 // This will run indefinitely until the context is cancelled
 func (b *Beacon) Start(ctx context.Context) error {
 	fmt.Println("Starting DNS beacon loop...")
-	fmt.Printf("Base delay: %s, Jitter: ±%s\n", b.baseDelay, b.jitter)
 	fmt.Println("Press Ctrl+C to stop\n")
 
 	queryCount := 0
@@ -73,11 +82,11 @@ func (b *Beacon) Start(ctx context.Context) error {
 			}
 		}
 
-		// Calculate next delay with jitter
-		delay := b.calculateDelay()
+		// Ask the scheduler how long to wait before the next query
+		delay := b.scheduler.NextDelay(ctx)
 		fmt.Printf("  ⏱  Next query in %s\n\n", delay)
 
-		// Wait for the calculated delay
+		// Wait for the scheduled delay
 		select {
 		case <-time.After(delay):
 			// Continue to next query
@@ -87,37 +96,3 @@ func (b *Beacon) Start(ctx context.Context) error {
 		}
 	}
 }
-
-// calculateDelay adds random jitter to the base delay
-// This makes the beacon appear more realistic and evades simple interval-based detection
-func (b *Beacon) calculateDelay() time.Duration {
-	if b.jitter == 0 {
-		return b.baseDelay
-	}
-
-	// Generate random jitter between -jitter and +jitter
-	// For example, if jitter is 2 seconds, we'll get a value between -2s and +2s
-	maxJitter := int64(b.jitter)
-	jitterRange := maxJitter * 2 // Total range is 2x jitter (from -jitter to +jitter)
-
-	// Generate secure random number
-	randomJitter, err := rand.Int(rand.Reader, big.NewInt(jitterRange))
-	if err != nil {
-		// If random generation fails, just use base delay
-		return b.baseDelay
-	}
-
-	// Convert to signed value and adjust
-	// Subtract maxJitter to shift range from [0, 2*jitter] to [-jitter, +jitter]
-	jitterValue := time.Duration(randomJitter.Int64() - maxJitter)
-
-	// Calculate final delay
-	finalDelay := b.baseDelay + jitterValue
-
-	// Ensure we never have a negative or zero delay
-	if finalDelay < time.Second {
-		finalDelay = time.Second
-	}
-
-	return finalDelay
-}
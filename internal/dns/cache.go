@@ -0,0 +1,272 @@
+package dns
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheKey identifies a cached answer by question name/type/class
+type cacheKey struct {
+	qname  string // lowercased, FQDN form
+	qtype  uint16
+	qclass uint16
+}
+
+// cacheEntry holds a cached response plus enough bookkeeping to age out TTLs
+type cacheEntry struct {
+	msg        *dns.Msg
+	insertedAt time.Time
+	ttl        time.Duration // minimum TTL across the response at insertion time
+	listElem   *list.Element
+}
+
+// CacheStats reports cache hit/miss/eviction counters
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// ResponseCache is a bounded, TTL-aware LRU cache for DNS responses.
+// It's shared across all listeners (plain/DoH/DoT/DoQ) so a repeated beacon
+// query doesn't re-hit the handler for every protocol.
+type ResponseCache struct {
+	mu          sync.Mutex
+	entries     map[cacheKey]*cacheEntry
+	order       *list.List // front = most recently used
+	maxEntries  int
+	negativeTTL time.Duration
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewResponseCache creates a cache bounded to maxEntries, with negativeTTL
+// used for NXDOMAIN answers (which otherwise carry no TTL of their own)
+func NewResponseCache(maxEntries int, negativeTTL time.Duration) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = 30 * time.Second
+	}
+
+	return &ResponseCache{
+		entries:     make(map[cacheKey]*cacheEntry),
+		order:       list.New(),
+		maxEntries:  maxEntries,
+		negativeTTL: negativeTTL,
+	}
+}
+
+func cacheKeyFor(qname string, qtype, qclass uint16) cacheKey {
+	return cacheKey{qname: strings.ToLower(dns.Fqdn(qname)), qtype: qtype, qclass: qclass}
+}
+
+// Get looks up a cached response, decrementing each RR's TTL by the time
+// elapsed since insertion. A response whose remaining TTL has reached zero
+// is treated as a miss and evicted.
+func (c *ResponseCache) Get(qname string, qtype, qclass uint16) (*dns.Msg, bool) {
+	key := cacheKeyFor(qname, qtype, qclass)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	elapsed := time.Since(entry.insertedAt)
+	remaining := entry.ttl - elapsed
+	if remaining <= 0 {
+		c.removeLocked(key, entry)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(entry.listElem)
+	c.hits++
+
+	return ageMessage(entry.msg, elapsed), true
+}
+
+// Set stores a response, deriving its expiry from the minimum TTL across the
+// message (or the configured negative TTL for NXDOMAIN/NODATA answers)
+func (c *ResponseCache) Set(qname string, qtype, qclass uint16, msg *dns.Msg) {
+	ttl := c.negativeTTL
+	if msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0 {
+		ttl = minRRTTL(msg)
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	key := cacheKeyFor(qname, qtype, qclass)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.entries[key]; ok {
+		c.order.MoveToFront(existing.listElem)
+		existing.msg = msg.Copy()
+		existing.insertedAt = time.Now()
+		existing.ttl = ttl
+		return
+	}
+
+	for len(c.entries) >= c.maxEntries {
+		c.evictOldestLocked()
+	}
+
+	entry := &cacheEntry{
+		msg:        msg.Copy(),
+		insertedAt: time.Now(),
+		ttl:        ttl,
+	}
+	entry.listElem = c.order.PushFront(key)
+	c.entries[key] = entry
+}
+
+func (c *ResponseCache) evictOldestLocked() {
+	oldest := c.order.Back()
+	if oldest == nil {
+		return
+	}
+	key := oldest.Value.(cacheKey)
+	c.removeLocked(key, c.entries[key])
+	c.evictions++
+}
+
+func (c *ResponseCache) removeLocked(key cacheKey, entry *cacheEntry) {
+	if entry != nil && entry.listElem != nil {
+		c.order.Remove(entry.listElem)
+	}
+	delete(c.entries, key)
+}
+
+// GetStats returns a snapshot of cache counters
+func (c *ResponseCache) GetStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries),
+	}
+}
+
+// minRRTTL returns the smallest TTL across the answer/authority/additional
+// sections, which bounds how long the whole response can be safely cached
+func minRRTTL(msg *dns.Msg) time.Duration {
+	var min uint32
+	found := false
+
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				// The EDNS0 OPT pseudo-record repurposes Hdr.Ttl to carry
+				// extended RCODE/flags, not a real TTL; folding it into the
+				// minimum would cache every EDNS response for 0 seconds.
+				continue
+			}
+			ttl := rr.Header().Ttl
+			if !found || ttl < min {
+				min = ttl
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return 0
+	}
+	return time.Duration(min) * time.Second
+}
+
+// ageMessage returns a deep copy of msg with every RR's TTL reduced by elapsed,
+// floored at zero so a response is never returned with a negative TTL
+func ageMessage(msg *dns.Msg, elapsed time.Duration) *dns.Msg {
+	aged := msg.Copy()
+	elapsedSecs := uint32(elapsed / time.Second)
+
+	for _, section := range [][]dns.RR{aged.Answer, aged.Ns, aged.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				// Not a real TTL (see minRRTTL); leave the OPT record alone.
+				continue
+			}
+			hdr := rr.Header()
+			if hdr.Ttl > elapsedSecs {
+				hdr.Ttl -= elapsedSecs
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+
+	return aged
+}
+
+// CachingHandler decorates any dns.Handler with the ResponseCache above,
+// so it composes cleanly with *Server or *ForwardingHandler.
+type CachingHandler struct {
+	next  dns.Handler
+	cache *ResponseCache
+}
+
+// NewCachingHandler wraps next with a bounded, TTL-aware cache
+func NewCachingHandler(next dns.Handler, maxEntries int, negativeTTL time.Duration) *CachingHandler {
+	return &CachingHandler{
+		next:  next,
+		cache: NewResponseCache(maxEntries, negativeTTL),
+	}
+}
+
+// ServeDNS implements dns.Handler, answering from cache when possible
+func (h *CachingHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		h.next.ServeDNS(w, r)
+		return
+	}
+	q := r.Question[0]
+
+	if cached, ok := h.cache.Get(q.Name, q.Qtype, q.Qclass); ok {
+		cached.Id = r.Id
+		w.WriteMsg(cached)
+		return
+	}
+
+	capture := &cachingResponseWriter{ResponseWriter: w}
+	h.next.ServeDNS(capture, r)
+
+	if capture.msg != nil {
+		h.cache.Set(q.Name, q.Qtype, q.Qclass, capture.msg)
+	}
+}
+
+// GetStats exposes the underlying cache's hit/miss/eviction counters
+func (h *CachingHandler) GetStats() CacheStats {
+	return h.cache.GetStats()
+}
+
+// cachingResponseWriter captures the message written by the wrapped handler
+// while still forwarding it to the real ResponseWriter
+type cachingResponseWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *cachingResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return w.ResponseWriter.WriteMsg(m)
+}
@@ -0,0 +1,31 @@
+package dns
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/faanross/dns-encryption-simulator/internal/control"
+)
+
+// ControlObserverHandler decorates a dns.Handler, reporting every query it
+// sees to a control.Hub so an agent's pre-declared plan (see
+// control.Client.ReportQueryPlan) can be joined against what the responder
+// actually received, without correlating logs across two machines by hand.
+type ControlObserverHandler struct {
+	next      dns.Handler
+	hub       *control.Hub
+	transport string
+}
+
+// NewControlObserverHandler wraps next, reporting queries it receives under
+// transport's label to hub.
+func NewControlObserverHandler(next dns.Handler, hub *control.Hub, transport string) *ControlObserverHandler {
+	return &ControlObserverHandler{next: next, hub: hub, transport: transport}
+}
+
+// ServeDNS implements dns.Handler
+func (h *ControlObserverHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) > 0 {
+		h.hub.Observe(r.Question[0].Name, h.transport)
+	}
+	h.next.ServeDNS(w, r)
+}
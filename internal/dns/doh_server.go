@@ -3,6 +3,7 @@ package dns
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
@@ -10,12 +11,13 @@ import (
 	"net/http"
 	"time"
 
+	ourtls "github.com/faanross/dns-encryption-simulator/internal/tls"
 	"github.com/miekg/dns"
 )
 
 // DoHServer handles DNS-over-HTTPS requests
 type DoHServer struct {
-	handler    *Server // Reuse our existing DNS handler
+	handler    dns.Handler // Reuse our existing DNS handler (or a ForwardingHandler)
 	httpServer *http.Server
 	address    string
 	certFile   string
@@ -23,7 +25,7 @@ type DoHServer struct {
 }
 
 // NewDoHServer creates a new DoH server
-func NewDoHServer(handler *Server, address string, certFile string, keyFile string) *DoHServer {
+func NewDoHServer(handler dns.Handler, address string, certFile string, keyFile string) *DoHServer {
 	return &DoHServer{
 		handler:  handler,
 		address:  address,
@@ -51,9 +53,17 @@ func (s *DoHServer) Start() error {
 		http.NotFound(w, r)
 	})
 
+	// Load TLS certificate ourselves (rather than via ListenAndServeTLS) so
+	// we can wrap the listener below and time the handshake
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
 	// Configure TLS
 	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
 		CurvePreferences: []tls.CurveID{
 			tls.CurveP256,
 			tls.X25519,
@@ -75,11 +85,20 @@ func (s *DoHServer) Start() error {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Listen on our own raw TCP socket and wrap it in a timing TLS listener
+	// so we can record handshake duration, then hand that listener to the
+	// HTTP server instead of letting ListenAndServeTLS create its own
+	rawListener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+	timingListener := ourtls.NewTimingListener(rawListener, tlsConfig, "doh")
+
 	fmt.Printf("Starting DoH server on %s (HTTPS)\n", s.address)
 
 	// Start HTTPS server
 	// This blocks until server stops
-	if err := s.httpServer.ListenAndServeTLS(s.certFile, s.keyFile); err != nil && err != http.ErrServerClosed {
+	if err := s.httpServer.Serve(timingListener); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start HTTPS server: %w", err)
 	}
 
@@ -88,25 +107,42 @@ func (s *DoHServer) Start() error {
 
 // handleDoHRequest processes a DNS-over-HTTPS request
 func (s *DoHServer) handleDoHRequest(w http.ResponseWriter, r *http.Request) {
-	// Only accept POST for now (most common)
-	// GET is also valid per RFC 8484 but less common
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST method supported", http.StatusMethodNotAllowed)
-		return
-	}
+	var body []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		// Verify content type
+		contentType := r.Header.Get("Content-Type")
+		if contentType != "application/dns-message" {
+			http.Error(w, "Content-Type must be application/dns-message", http.StatusBadRequest)
+			return
+		}
 
-	// Verify content type
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/dns-message" {
-		http.Error(w, "Content-Type must be application/dns-message", http.StatusBadRequest)
-		return
-	}
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Failed to read request body: %v", err)
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
 
-	// Read DNS message from request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
-		http.Error(w, "Failed to read request", http.StatusBadRequest)
+	case http.MethodGet:
+		// RFC 8484 §4.1.1: the wire-format query is base64url (no padding)
+		// encoded into the "dns" query parameter
+		encoded := r.URL.Query().Get("dns")
+		if encoded == "" {
+			http.Error(w, "missing dns query parameter", http.StatusBadRequest)
+			return
+		}
+		body, err = base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			log.Printf("Failed to decode dns query parameter: %v", err)
+			http.Error(w, "invalid dns query parameter", http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "Only GET and POST methods supported", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -131,16 +167,23 @@ func (s *DoHServer) handleDoHRequest(w http.ResponseWriter, r *http.Request) {
 	// Process the query using our existing handler
 	s.handler.ServeDNS(dnsWriter, query)
 
-	// Pack the DNS response into wire format
-	responseBytes, err := response.Pack()
+	// Pack the DNS response into wire format. dnsWriter.response, not the
+	// local response SetReply built, since WriteMsg reassigns the pointer
+	// to the handler's own message rather than mutating through it.
+	responseBytes, err := dnsWriter.response.Pack()
 	if err != nil {
 		log.Printf("Failed to pack DNS response: %v", err)
 		http.Error(w, "Failed to create response", http.StatusInternalServerError)
 		return
 	}
 
-	// Send HTTP response with DNS message
+	// Send HTTP response with DNS message, advertising the answer's TTL so
+	// an HTTP cache in front of us (or the browser) doesn't hold it longer
+	// than the DNS response itself is valid for
 	w.Header().Set("Content-Type", "application/dns-message")
+	if ttl := minRRTTL(dnsWriter.response); ttl > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl.Seconds())))
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(responseBytes)
 }
@@ -162,7 +205,6 @@ type dohResponseWriter struct {
 }
 
 func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error {
-	// Copy the response
 	w.response = m
 	return nil
 }
@@ -0,0 +1,169 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/faanross/dns-encryption-simulator/internal/metrics"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQServer handles DNS-over-QUIC requests per RFC 9250
+type DoQServer struct {
+	handler  dns.Handler // Reuse our existing DNS handler (or a ForwardingHandler)
+	listener *quic.Listener
+	address  string
+	certFile string
+	keyFile  string
+}
+
+// NewDoQServer creates a new DoQ server
+func NewDoQServer(handler dns.Handler, address string, certFile string, keyFile string) *DoQServer {
+	return &DoQServer{
+		handler:  handler,
+		address:  address,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// Start begins listening for DoQ requests
+func (s *DoQServer) Start() error {
+	// Load TLS certificate
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	// RFC 9250 §4.1.1 requires TLS 1.3 and the "doq" ALPN token
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+		NextProtos:   []string{"doq"},
+	}
+
+	listener, err := quic.ListenAddr(s.address, tlsConfig, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start QUIC listener: %w", err)
+	}
+	s.listener = listener
+
+	fmt.Printf("Starting DoQ server on %s (QUIC)\n", s.address)
+
+	// Accept connections until the listener is closed. QUIC folds the TLS
+	// 1.3 handshake into connection establishment, so Accept's duration is
+	// our handshake-duration measurement.
+	for {
+		start := time.Now()
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to accept QUIC connection: %w", err)
+		}
+		metrics.TLSHandshakeDuration.WithLabelValues("doq").Observe(time.Since(start).Seconds())
+		go s.handleConnection(conn)
+	}
+}
+
+// handleConnection accepts streams on a QUIC connection
+// RFC 9250 allows multiple streams per connection, each carrying one query/response
+func (s *DoQServer) handleConnection(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			// Connection closed or errored, nothing more to accept
+			return
+		}
+		go s.handleStream(stream)
+	}
+}
+
+// handleStream processes a single DoQ stream: one query in, one response out
+func (s *DoQServer) handleStream(stream quic.Stream) {
+	defer stream.Close()
+
+	// RFC 9250 §4.2: messages are prefixed with a 2-byte length field
+	lengthBuf := make([]byte, 2)
+	if _, err := io.ReadFull(stream, lengthBuf); err != nil {
+		return
+	}
+	length := binary.BigEndian.Uint16(lengthBuf)
+
+	msgBuf := make([]byte, length)
+	if _, err := io.ReadFull(stream, msgBuf); err != nil {
+		return
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(msgBuf); err != nil {
+		return
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+
+	// Use our existing DNS handler logic via a ResponseWriter shim
+	dnsWriter := &doqResponseWriter{response: response}
+	s.handler.ServeDNS(dnsWriter, query)
+
+	responseBytes, err := dnsWriter.response.Pack()
+	if err != nil {
+		return
+	}
+
+	respLengthBuf := make([]byte, 2)
+	binary.BigEndian.PutUint16(respLengthBuf, uint16(len(responseBytes)))
+
+	if _, err := stream.Write(respLengthBuf); err != nil {
+		return
+	}
+	stream.Write(responseBytes)
+}
+
+// Stop gracefully shuts down the server
+func (s *DoQServer) Stop() error {
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// doqResponseWriter implements dns.ResponseWriter for DoQ
+// This allows us to reuse our existing DNS handler logic (analogous to dohResponseWriter)
+type doqResponseWriter struct {
+	response *dns.Msg
+}
+
+func (w *doqResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.response = m
+	return nil
+}
+
+func (w *doqResponseWriter) Write([]byte) (int, error) {
+	return 0, fmt.Errorf("Write not supported in DoQ")
+}
+
+func (w *doqResponseWriter) LocalAddr() net.Addr {
+	return nil
+}
+
+func (w *doqResponseWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0}
+}
+
+func (w *doqResponseWriter) TsigStatus() error {
+	return nil
+}
+
+func (w *doqResponseWriter) TsigTimersOnly(bool) {}
+
+func (w *doqResponseWriter) Hijack() {}
+
+func (w *doqResponseWriter) Close() error {
+	return nil
+}
@@ -3,13 +3,15 @@ package dns
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 
+	ourtls "github.com/faanross/dns-encryption-simulator/internal/tls"
 	"github.com/miekg/dns"
 )
 
 // DoTServer handles DNS-over-TLS requests
 type DoTServer struct {
-	handler  *Server // Reuse our existing DNS handler
+	handler  dns.Handler // Reuse our existing DNS handler (or a ForwardingHandler)
 	server   *dns.Server
 	address  string
 	certFile string
@@ -17,7 +19,7 @@ type DoTServer struct {
 }
 
 // NewDoTServer creates a new DoT server
-func NewDoTServer(handler *Server, address string, certFile string, keyFile string) *DoTServer {
+func NewDoTServer(handler dns.Handler, address string, certFile string, keyFile string) *DoTServer {
 	return &DoTServer{
 		handler:  handler,
 		address:  address,
@@ -50,21 +52,26 @@ func (s *DoTServer) Start() error {
 		},
 	}
 
-	// Create DNS server with TLS
-	// The miekg/dns library makes this very simple
-	// We just specify "tcp-tls" as the network type
+	// Listen on our own raw TCP socket and wrap it in a timing TLS listener
+	// so we can record handshake duration, then hand that listener to the
+	// miekg/dns server instead of letting it create its own
+	rawListener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+	timingListener := ourtls.NewTimingListener(rawListener, tlsConfig, "dot")
+
 	s.server = &dns.Server{
-		Addr:      s.address,
-		Net:       "tcp-tls", // This enables TLS for incoming connections
-		Handler:   s.handler, // Reuse our existing DNS handler
-		TLSConfig: tlsConfig,
+		Net:      "tcp-tls",
+		Listener: timingListener,
+		Handler:  s.handler, // Reuse our existing DNS handler
 	}
 
 	fmt.Printf("Starting DoT server on %s (TLS)\n", s.address)
 
 	// Start listening
 	// This blocks until server stops
-	if err := s.server.ListenAndServe(); err != nil {
+	if err := s.server.ActivateAndServe(); err != nil {
 		return fmt.Errorf("failed to start DoT server: %w", err)
 	}
 
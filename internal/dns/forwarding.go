@@ -0,0 +1,385 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+
+	"github.com/faanross/dns-encryption-simulator/internal/config"
+)
+
+// ForwardingHandler wraps our authoritative Server, answering our own zone
+// locally and forwarding everything else to a configured upstream instead of
+// NXDOMAINing it. This is what turns the simulator into a usable DoH/DoT/DoQ
+// gateway rather than just a beacon target.
+type ForwardingHandler struct {
+	handler  *Server
+	upstream upstreamClient
+}
+
+// NewForwardingHandler builds a ForwardingHandler from an UpstreamConfig,
+// parsing the address in AddressToUpstream form (udp://, tls://, https://, quic://)
+func NewForwardingHandler(handler *Server, cfg config.UpstreamConfig) (*ForwardingHandler, error) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	upstream, err := parseUpstream(cfg.Address, cfg.BootstrapResolver, timeout, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure upstream %q: %w", cfg.Address, err)
+	}
+
+	return &ForwardingHandler{handler: handler, upstream: upstream}, nil
+}
+
+// ServeDNS implements dns.Handler. Out-of-zone queries are forwarded upstream;
+// everything else goes through the existing authoritative handler unchanged.
+func (f *ForwardingHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 || !f.handler.isOurDomain(r.Question[0].Name) {
+		f.forward(w, r)
+		return
+	}
+	f.handler.ServeDNS(w, r)
+}
+
+// forward relays a query to the upstream and writes back whatever it returns
+func (f *ForwardingHandler) forward(w dns.ResponseWriter, r *dns.Msg) {
+	response, err := f.upstream.exchange(r)
+	if err != nil {
+		log.Printf("upstream forward failed: %v", err)
+		fail := new(dns.Msg)
+		fail.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(fail)
+		return
+	}
+
+	response.Id = r.Id
+	if err := w.WriteMsg(response); err != nil {
+		log.Printf("failed to write forwarded response: %v", err)
+	}
+}
+
+// Close releases any resources held by the upstream connection
+func (f *ForwardingHandler) Close() error {
+	return f.upstream.close()
+}
+
+// upstreamClient is the minimal contract a forwarding target must satisfy.
+// Unlike modes.DNSClient (which only resolves A records for a domain name),
+// forwarding needs to relay arbitrary DNS messages verbatim.
+type upstreamClient interface {
+	exchange(m *dns.Msg) (*dns.Msg, error)
+	close() error
+}
+
+// parseUpstream builds an upstreamClient from a dnsproxy-style address string
+func parseUpstream(address string, bootstrapResolver string, timeout time.Duration, insecure bool) (upstreamClient, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address: %w", err)
+	}
+
+	host := u.Hostname()
+	resolvedHost, err := resolveBootstrap(host, bootstrapResolver, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "udp":
+		addr := net.JoinHostPort(resolvedHost, portOr(u.Port(), "53"))
+		return newUDPUpstream(addr, timeout), nil
+
+	case "tls":
+		addr := net.JoinHostPort(resolvedHost, portOr(u.Port(), "853"))
+		return newTLSUpstream(addr, host, timeout, insecure), nil
+
+	case "https":
+		port := portOr(u.Port(), "443")
+		return newHTTPSUpstream(address, host, net.JoinHostPort(resolvedHost, port), timeout, insecure), nil
+
+	case "quic":
+		addr := net.JoinHostPort(resolvedHost, portOr(u.Port(), "853"))
+		return newQUICUpstream(addr, host, timeout, insecure), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.Scheme)
+	}
+}
+
+func portOr(port, fallback string) string {
+	if port == "" {
+		return fallback
+	}
+	return port
+}
+
+// resolveBootstrap resolves an upstream hostname to an IP using only the
+// configured bootstrap resolver, so the system resolver is never consulted
+func resolveBootstrap(host string, bootstrapResolver string, timeout time.Duration) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return host, nil
+	}
+
+	if bootstrapResolver == "" {
+		return "", fmt.Errorf("upstream hostname %q requires a bootstrap resolver", host)
+	}
+
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(host), dns.TypeA)
+	msg.RecursionDesired = true
+
+	response, _, err := client.Exchange(msg, bootstrapResolver)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap resolution of %q via %s failed: %w", host, bootstrapResolver, err)
+	}
+
+	for _, answer := range response.Answer {
+		if a, ok := answer.(*dns.A); ok {
+			return a.A.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("bootstrap resolver returned no A record for %q", host)
+}
+
+// ---------- udp:// ----------
+
+type udpUpstream struct {
+	addr   string
+	client *dns.Client
+}
+
+func newUDPUpstream(addr string, timeout time.Duration) *udpUpstream {
+	return &udpUpstream{
+		addr:   addr,
+		client: &dns.Client{Net: "udp", Timeout: timeout, UDPSize: 4096},
+	}
+}
+
+func (u *udpUpstream) exchange(m *dns.Msg) (*dns.Msg, error) {
+	response, _, err := u.client.Exchange(m, u.addr)
+	if err != nil {
+		return nil, fmt.Errorf("udp upstream exchange failed: %w", err)
+	}
+	return response, nil
+}
+
+func (u *udpUpstream) close() error { return nil }
+
+// ---------- tls:// ----------
+
+type tlsUpstream struct {
+	addr   string
+	client *dns.Client
+}
+
+func newTLSUpstream(addr string, serverName string, timeout time.Duration, insecure bool) *tlsUpstream {
+	client := &dns.Client{
+		Net:     "tcp-tls",
+		Timeout: timeout,
+		TLSConfig: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: insecure,
+			MinVersion:         tls.VersionTLS12,
+		},
+	}
+	return &tlsUpstream{addr: addr, client: client}
+}
+
+func (u *tlsUpstream) exchange(m *dns.Msg) (*dns.Msg, error) {
+	response, _, err := u.client.Exchange(m, u.addr)
+	if err != nil {
+		return nil, fmt.Errorf("tls upstream exchange failed: %w", err)
+	}
+	return response, nil
+}
+
+func (u *tlsUpstream) close() error { return nil }
+
+// ---------- https:// ----------
+
+type httpsUpstream struct {
+	url    string
+	client *http.Client
+}
+
+// newHTTPSUpstream dials the bootstrap-resolved address directly while keeping
+// the original hostname for SNI and the HTTP Host header
+func newHTTPSUpstream(rawURL string, originalHost string, dialAddr string, timeout time.Duration, insecure bool) *httpsUpstream {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			ServerName:         originalHost,
+			InsecureSkipVerify: insecure,
+			MinVersion:         tls.VersionTLS12,
+		},
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{Timeout: timeout}).DialContext(ctx, network, dialAddr)
+		},
+		ForceAttemptHTTP2: true,
+	}
+
+	return &httpsUpstream{
+		url:    rawURL,
+		client: &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+func (u *httpsUpstream) exchange(m *dns.Msg) (*dns.Msg, error) {
+	wireFormat, err := m.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS message: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.url, bytes.NewReader(wireFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("https upstream request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("https upstream returned HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read https upstream response: %w", err)
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to unpack https upstream response: %w", err)
+	}
+
+	return response, nil
+}
+
+func (u *httpsUpstream) close() error {
+	u.client.CloseIdleConnections()
+	return nil
+}
+
+// ---------- quic:// ----------
+
+type quicUpstream struct {
+	addr       string
+	serverName string
+	timeout    time.Duration
+	insecure   bool
+
+	mu   sync.Mutex
+	conn quic.Connection
+}
+
+func newQUICUpstream(addr string, serverName string, timeout time.Duration, insecure bool) *quicUpstream {
+	return &quicUpstream{addr: addr, serverName: serverName, timeout: timeout, insecure: insecure}
+}
+
+func (u *quicUpstream) connect(ctx context.Context) (quic.Connection, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil {
+		return u.conn, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.serverName,
+		InsecureSkipVerify: u.insecure,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         []string{"doq"},
+	}
+
+	conn, err := quic.DialAddr(ctx, u.addr, tlsConfig, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial QUIC upstream: %w", err)
+	}
+
+	u.conn = conn
+	return conn, nil
+}
+
+func (u *quicUpstream) exchange(m *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+	defer cancel()
+
+	conn, err := u.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := m.Copy()
+	query.Id = 0 // RFC 9250 §4.2.1
+
+	wireFormat, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS message: %w", err)
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		u.mu.Lock()
+		u.conn = nil
+		u.mu.Unlock()
+		return nil, fmt.Errorf("failed to open QUIC stream: %w", err)
+	}
+	defer stream.Close()
+
+	lengthPrefix := make([]byte, 2)
+	binary.BigEndian.PutUint16(lengthPrefix, uint16(len(wireFormat)))
+	if _, err := stream.Write(append(lengthPrefix, wireFormat...)); err != nil {
+		return nil, fmt.Errorf("failed to write query: %w", err)
+	}
+	stream.Close()
+
+	respLengthBuf := make([]byte, 2)
+	if _, err := io.ReadFull(stream, respLengthBuf); err != nil {
+		return nil, fmt.Errorf("failed to read response length: %w", err)
+	}
+	respLength := binary.BigEndian.Uint16(respLengthBuf)
+
+	respBuf := make([]byte, respLength)
+	if _, err := io.ReadFull(stream, respBuf); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(respBuf); err != nil {
+		return nil, fmt.Errorf("failed to unpack QUIC upstream response: %w", err)
+	}
+
+	return response, nil
+}
+
+func (u *quicUpstream) close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil {
+		err := u.conn.CloseWithError(0, "")
+		u.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"log"
+	"time"
+
+	"github.com/faanross/dns-encryption-simulator/internal/metrics"
+	"github.com/miekg/dns"
+)
+
+// MetricsHandler decorates a dns.Handler, recording per-protocol Prometheus
+// counters and histograms for every query it serves. One instance is created
+// per listener (plain/doh/dot/doq), since the protocol a query arrived on
+// can't otherwise be recovered from inside ServeDNS.
+type MetricsHandler struct {
+	next     dns.Handler
+	protocol string
+}
+
+// NewMetricsHandler wraps next, recording metrics under protocol's label
+func NewMetricsHandler(next dns.Handler, protocol string) *MetricsHandler {
+	return &MetricsHandler{next: next, protocol: protocol}
+}
+
+// ServeDNS implements dns.Handler
+func (h *MetricsHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	start := time.Now()
+	capture := &captureResponseWriter{ResponseWriter: w}
+
+	h.next.ServeDNS(capture, r)
+
+	metrics.QueryDuration.WithLabelValues(h.protocol).Observe(time.Since(start).Seconds())
+
+	if capture.msg == nil {
+		return
+	}
+
+	qtype := "UNKNOWN"
+	if len(r.Question) > 0 {
+		qtype = dns.TypeToString[r.Question[0].Qtype]
+	}
+	rcode := dns.RcodeToString[capture.msg.Rcode]
+
+	metrics.QueriesTotal.WithLabelValues(h.protocol, qtype, rcode).Inc()
+	metrics.ResponseBytes.WithLabelValues(h.protocol).Observe(float64(capture.msg.Len()))
+
+	if err := w.WriteMsg(capture.msg); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"log"
+
+	"github.com/miekg/dns"
+)
+
+// Recommended padding block sizes from RFC 8467's "Block-Length Padding"
+// strategy: queries are padded to the nearest 128 bytes, responses to 468.
+const (
+	QueryPaddingBlockSize    = 128
+	ResponsePaddingBlockSize = 468
+)
+
+// PadMessage attaches (or replaces) an EDNS(0) Padding option on m so that
+// ciphertext length over an encrypted transport doesn't leak the underlying
+// question/answer size, per RFC 7830. The wire-format length is rounded up
+// to the nearest multiple of blockSize, per RFC 8467.
+func PadMessage(m *dns.Msg, blockSize int) {
+	if blockSize <= 0 {
+		return
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		opt = new(dns.OPT)
+		opt.Hdr.Name = "."
+		opt.Hdr.Rrtype = dns.TypeOPT
+		opt.SetUDPSize(dns.DefaultMsgSize)
+		m.Extra = append(m.Extra, opt)
+	}
+
+	removePadding(opt)
+
+	padding := &dns.EDNS0_PADDING{Padding: []byte{}}
+	opt.Option = append(opt.Option, padding)
+
+	// m.Len() already accounts for the padding option's 4-byte option header,
+	// so the gap to the next block boundary is exactly how much to pad with
+	unpaddedLen := m.Len()
+	target := roundUpToBlock(unpaddedLen, blockSize)
+	if target > unpaddedLen {
+		padding.Padding = make([]byte, target-unpaddedLen)
+	}
+}
+
+// removePadding strips any existing padding option so PadMessage can be
+// called idempotently (e.g. if a message is padded more than once)
+func removePadding(opt *dns.OPT) {
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0PADDING {
+			kept = append(kept, o)
+		}
+	}
+	opt.Option = kept
+}
+
+func roundUpToBlock(length, blockSize int) int {
+	remainder := length % blockSize
+	if remainder == 0 {
+		return length
+	}
+	return length + (blockSize - remainder)
+}
+
+// PaddingHandler decorates a dns.Handler, padding every response it writes.
+// It's only wired onto the encrypted listeners (DoT/DoH/DoQ) — padding a
+// plain-DNS response over UDP would just waste bytes with nothing to hide.
+type PaddingHandler struct {
+	next dns.Handler
+}
+
+// NewPaddingHandler wraps next so its responses get RFC 7830/8467 padding
+func NewPaddingHandler(next dns.Handler) *PaddingHandler {
+	return &PaddingHandler{next: next}
+}
+
+// ServeDNS implements dns.Handler
+func (h *PaddingHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	capture := &captureResponseWriter{ResponseWriter: w}
+	h.next.ServeDNS(capture, r)
+
+	if capture.msg == nil {
+		return
+	}
+
+	PadMessage(capture.msg, ResponsePaddingBlockSize)
+	if err := w.WriteMsg(capture.msg); err != nil {
+		log.Printf("failed to write padded response: %v", err)
+	}
+}
+
+// captureResponseWriter captures the message written by the wrapped handler
+// without forwarding it, so a caller can mutate the message before the real
+// write happens (unlike cachingResponseWriter, which forwards immediately)
+type captureResponseWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *captureResponseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
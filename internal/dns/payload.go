@@ -0,0 +1,304 @@
+package dns
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+)
+
+// Alphabet selects the character set a PayloadEncoder/PayloadDecoder pair
+// uses to represent chunk bytes as DNS label text. Each trades entropy
+// signature (how the traffic looks to a detector) for capacity (bytes per
+// label).
+type Alphabet int
+
+const (
+	// AlphabetBase32 is the same lowercase, unpadded Base32 SubdomainGenerator
+	// uses for its noise, so payload-carrying queries blend in with it.
+	AlphabetBase32 Alphabet = iota
+	// AlphabetBase32Hex uses the "extended hex" Base32 variant (0-9, a-v).
+	AlphabetBase32Hex
+	// AlphabetBase64URLDNS is a DNS-safe variant of Base64URL: the standard
+	// alphabet's '-' is swapped for '~', which (unlike '-') is never
+	// ambiguous at a label boundary. 6 bits/char instead of Base32's 5 buys
+	// ~20% more payload per label at the cost of a less DNS-typical shape.
+	AlphabetBase64URLDNS
+)
+
+// dnsSafeBase64 is base64.URLEncoding with '-' swapped for '~'.
+var dnsSafeBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789~_").WithPadding(base64.NoPadding)
+
+// byteCodec is satisfied by both *base32.Encoding and *base64.Encoding,
+// letting PayloadEncoder/PayloadDecoder treat all three alphabets uniformly.
+type byteCodec interface {
+	EncodeToString(src []byte) string
+	DecodeString(s string) ([]byte, error)
+}
+
+// codec returns the byteCodec and bits-per-character for a, defaulting to
+// AlphabetBase32 for an unrecognized value.
+func (a Alphabet) codec() (byteCodec, int) {
+	switch a {
+	case AlphabetBase32Hex:
+		return base32.HexEncoding.WithPadding(base32.NoPadding), 5
+	case AlphabetBase64URLDNS:
+		return dnsSafeBase64, 6
+	default:
+		return base32.StdEncoding.WithPadding(base32.NoPadding), 5
+	}
+}
+
+// caseInsensitive reports whether a's alphabet can be folded to lowercase
+// (to blend in with SubdomainGenerator's noise) and safely recovered by
+// uppercasing before decode. Base64's mixed-case alphabet carries meaning
+// in the letter case itself, so it must round-trip unmodified.
+func (a Alphabet) caseInsensitive() bool {
+	return a != AlphabetBase64URLDNS
+}
+
+// payloadHeaderLen is the width, in hex characters, of the per-chunk header:
+// a 16-bit session ID, 16-bit chunk index, and 16-bit total-chunk count,
+// each as 4 fixed-width hex digits.
+const payloadHeaderLen = 12
+
+// maxLabelLen is the DNS limit on a single label.
+const maxLabelLen = 63
+
+// maxFQDNLen is the DNS limit on a full domain name.
+const maxFQDNLen = 253
+
+// PayloadEncoder splits an arbitrary byte payload into an ordered slice of
+// FQDNs suitable for exfiltration simulation: each FQDN carries one chunk,
+// identified by a session ID so a PayloadDecoder can reassemble out-of-order
+// arrivals, with the chunk's bytes spread across as many dot-separated
+// labels as the target domain's length allows.
+type PayloadEncoder struct {
+	sessionID uint16
+	alphabet  Alphabet
+}
+
+// NewPayloadEncoder creates a PayloadEncoder. sessionID identifies this
+// payload's chunks to the decoder, so concurrent transfers don't interleave.
+func NewPayloadEncoder(sessionID uint16, alphabet Alphabet) *PayloadEncoder {
+	return &PayloadEncoder{sessionID: sessionID, alphabet: alphabet}
+}
+
+// Encode splits payload into chunks and returns one FQDN per chunk, under
+// domain. A trailing CRC32 (IEEE) of the whole payload is appended before
+// chunking, so it lands at the tail of the reassembled data (in the last
+// chunk, or split across the last two) for PayloadDecoder to verify once
+// reassembly completes.
+func (e *PayloadEncoder) Encode(payload []byte, domain string) ([]string, error) {
+	codec, bitsPerChar := e.alphabet.codec()
+
+	labelChars := maxDataLen(labelBudget(domain))
+	if labelChars <= payloadHeaderLen {
+		return nil, fmt.Errorf("domain %q leaves no room for payload data after the header", domain)
+	}
+	dataChars := labelChars - payloadHeaderLen
+
+	chunkBytes := (dataChars * bitsPerChar) / 8
+	if chunkBytes < 1 {
+		chunkBytes = 1
+	}
+
+	withChecksum := appendCRC32(payload)
+
+	totalChunks := (len(withChecksum) + chunkBytes - 1) / chunkBytes
+	if totalChunks == 0 {
+		totalChunks = 1
+	}
+	if totalChunks > 0xFFFF {
+		return nil, fmt.Errorf("payload needs %d chunks, exceeds the 16-bit chunk count limit", totalChunks)
+	}
+
+	fqdns := make([]string, 0, totalChunks)
+	for i := 0; i < totalChunks; i++ {
+		start := i * chunkBytes
+		end := start + chunkBytes
+		if end > len(withChecksum) {
+			end = len(withChecksum)
+		}
+
+		header := fmt.Sprintf("%04x%04x%04x", e.sessionID, i, totalChunks)
+		encoded := codec.EncodeToString(withChecksum[start:end])
+		if e.alphabet.caseInsensitive() {
+			encoded = strings.ToLower(encoded)
+		}
+
+		fqdn := strings.Join(splitIntoLabels(header+encoded), ".") + "." + domain
+		if len(fqdn) > maxFQDNLen {
+			return nil, fmt.Errorf("encoded chunk %d produced a %d-character FQDN, exceeds %d", i, len(fqdn), maxFQDNLen)
+		}
+		fqdns = append(fqdns, fqdn)
+	}
+
+	return fqdns, nil
+}
+
+// labelBudget returns how many characters are available for (dot-joined)
+// data labels in front of domain, within the 253-character FQDN limit.
+func labelBudget(domain string) int {
+	return maxFQDNLen - len(domain) - 1 // -1 for the dot joining the last label to domain
+}
+
+// maxDataLen returns the longest string that, once split into ≤63-character
+// labels by splitIntoLabels, joins (with the dots between labels) into no
+// more than budget characters.
+func maxDataLen(budget int) int {
+	if budget <= 0 {
+		return 0
+	}
+
+	total := 0
+	remaining := budget
+	for remaining > 0 {
+		label := remaining
+		if label > maxLabelLen {
+			label = maxLabelLen
+		}
+		total += label
+		remaining -= label
+		if remaining > 0 {
+			remaining-- // the dot joining this label to the next
+		}
+	}
+	return total
+}
+
+// splitIntoLabels breaks s into the fewest possible ≤63-character labels.
+func splitIntoLabels(s string) []string {
+	if len(s) <= maxLabelLen {
+		return []string{s}
+	}
+
+	labels := make([]string, 0, (len(s)/maxLabelLen)+1)
+	for len(s) > 0 {
+		end := maxLabelLen
+		if end > len(s) {
+			end = len(s)
+		}
+		labels = append(labels, s[:end])
+		s = s[end:]
+	}
+	return labels
+}
+
+// appendCRC32 returns payload with a trailing big-endian CRC32 (IEEE) of
+// payload itself.
+func appendCRC32(payload []byte) []byte {
+	sum := crc32.ChecksumIEEE(payload)
+	out := make([]byte, len(payload)+4)
+	copy(out, payload)
+	out[len(payload)+0] = byte(sum >> 24)
+	out[len(payload)+1] = byte(sum >> 16)
+	out[len(payload)+2] = byte(sum >> 8)
+	out[len(payload)+3] = byte(sum)
+	return out
+}
+
+// verifyAndStripCRC32 validates the trailing CRC32 appended by appendCRC32
+// and returns the payload with it removed.
+func verifyAndStripCRC32(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("reassembled payload too short to contain a CRC32 trailer")
+	}
+
+	payload := data[:len(data)-4]
+	trailer := data[len(data)-4:]
+	want := uint32(trailer[0])<<24 | uint32(trailer[1])<<16 | uint32(trailer[2])<<8 | uint32(trailer[3])
+	got := crc32.ChecksumIEEE(payload)
+
+	if got != want {
+		return nil, fmt.Errorf("CRC32 mismatch: got %08x, want %08x", got, want)
+	}
+	return payload, nil
+}
+
+// pendingPayload tracks the chunks received so far for one session ID.
+type pendingPayload struct {
+	total  int
+	chunks map[int][]byte
+}
+
+// PayloadDecoder reassembles the chunks a PayloadEncoder produced, keyed by
+// session ID, tolerating out-of-order arrival.
+type PayloadDecoder struct {
+	alphabet Alphabet
+
+	mu       sync.Mutex
+	sessions map[uint16]*pendingPayload
+}
+
+// NewPayloadDecoder creates a PayloadDecoder for the given alphabet, which
+// must match the PayloadEncoder that produced the chunks it will see.
+func NewPayloadDecoder(alphabet Alphabet) *PayloadDecoder {
+	return &PayloadDecoder{
+		alphabet: alphabet,
+		sessions: make(map[uint16]*pendingPayload),
+	}
+}
+
+// Accept ingests the data labels of one chunk FQDN (i.e. the query name's
+// labels with the trailing domain suffix already removed by the caller). It
+// returns the reassembled, CRC32-verified payload once every chunk for its
+// session has arrived; ok is false while chunks are still outstanding.
+func (d *PayloadDecoder) Accept(labels []string) (payload []byte, ok bool, err error) {
+	joined := strings.Join(labels, "")
+	if len(joined) < payloadHeaderLen {
+		return nil, false, fmt.Errorf("label data (%d chars) shorter than the %d-char header", len(joined), payloadHeaderLen)
+	}
+
+	var sessionID, index, total uint16
+	if _, err := fmt.Sscanf(joined[:payloadHeaderLen], "%04x%04x%04x", &sessionID, &index, &total); err != nil {
+		return nil, false, fmt.Errorf("failed to parse chunk header: %w", err)
+	}
+	if total == 0 {
+		return nil, false, fmt.Errorf("chunk header reports zero total chunks")
+	}
+
+	codec, _ := d.alphabet.codec()
+	data := joined[payloadHeaderLen:]
+	if d.alphabet.caseInsensitive() {
+		data = strings.ToUpper(data)
+	}
+	chunk, err := codec.DecodeString(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode chunk %d data: %w", index, err)
+	}
+
+	d.mu.Lock()
+	sess, exists := d.sessions[sessionID]
+	if !exists {
+		sess = &pendingPayload{total: int(total), chunks: make(map[int][]byte)}
+		d.sessions[sessionID] = sess
+	}
+	sess.chunks[int(index)] = chunk
+	complete := len(sess.chunks) >= sess.total
+	if complete {
+		delete(d.sessions, sessionID)
+	}
+	d.mu.Unlock()
+
+	if !complete {
+		return nil, false, nil
+	}
+
+	reassembled := make([]byte, 0, sess.total*len(chunk))
+	for i := 0; i < sess.total; i++ {
+		part, ok := sess.chunks[i]
+		if !ok {
+			return nil, false, fmt.Errorf("session %04x missing chunk %d/%d", sessionID, i, sess.total)
+		}
+		reassembled = append(reassembled, part...)
+	}
+
+	verified, err := verifyAndStripCRC32(reassembled)
+	if err != nil {
+		return nil, true, fmt.Errorf("session %04x: %w", sessionID, err)
+	}
+	return verified, true, nil
+}
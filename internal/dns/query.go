@@ -6,19 +6,16 @@ import (
 	"net"
 	"time"
 
+	"github.com/faanross/dns-encryption-simulator/internal/modes"
+	"github.com/faanross/dns-encryption-simulator/internal/timing"
 	"github.com/miekg/dns"
 )
 
-// QueryResult contains the results of a DNS query
-type QueryResult struct {
-	Domain    string        // The FQDN that was queried
-	Response  *dns.Msg      // The full DNS response message
-	RTT       time.Duration // Round-trip time
-	Server    string        // Which server answered
-	Error     error         // Any error that occurred
-	Answers   []string      // IP addresses from answer section (if any)
-	QueryTime time.Time     // When the query was sent
-}
+// QueryResult contains the results of a DNS query. It's an alias for
+// modes.QueryResult (rather than a second, independently-drifting
+// definition) so PlainDNSClient's results and modes.DNSClient's results are
+// interchangeable wherever a caller handles both, e.g. Beacon's fields.
+type QueryResult = modes.QueryResult
 
 // PlainDNSClient performs standard DNS queries over UDP
 type PlainDNSClient struct {
@@ -102,9 +99,17 @@ func (c *PlainDNSClient) Query(ctx context.Context, domain string) (*QueryResult
 	return result, nil
 }
 
+// retryBackoffBase and retryBackoffCap bound QueryWithRetry's decorrelated
+// jitter backoff (AWS-style: sleep = min(cap, random_between(base, prev*3))).
+const (
+	retryBackoffBase = 1 * time.Second
+	retryBackoffCap  = 30 * time.Second
+)
+
 // QueryWithRetry performs a query with automatic retries on failure
 func (c *PlainDNSClient) QueryWithRetry(ctx context.Context, domain string, maxRetries int) (*QueryResult, error) {
 	var lastErr error
+	backoff := timing.NewDecorrelatedJitter(retryBackoffBase, retryBackoffCap)
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		// Check if context was cancelled
@@ -131,13 +136,12 @@ func (c *PlainDNSClient) QueryWithRetry(ctx context.Context, domain string, maxR
 
 		// If this wasn't the last attempt, wait before retrying
 		if attempt < maxRetries {
-			// Exponential backoff: wait longer after each failure
-			backoff := time.Duration(attempt+1) * time.Second
+			delay := backoff.NextDelay(ctx)
 			fmt.Printf("Query failed (attempt %d/%d), retrying in %s: %v\n",
-				attempt+1, maxRetries+1, backoff, err)
+				attempt+1, maxRetries+1, delay, err)
 
 			select {
-			case <-time.After(backoff):
+			case <-time.After(delay):
 				// Continue to next attempt
 			case <-ctx.Done():
 				return nil, ctx.Err()
@@ -162,6 +166,7 @@ const (
 	ResolverTypeLocal         ResolverType = 1 // System resolver
 	ResolverTypePublic        ResolverType = 2 // Specific public resolver
 	ResolverTypeAuthoritative ResolverType = 3 // Direct to authoritative NS
+	ResolverTypeRecursive     ResolverType = 4 // Self-driven recursion from the root, via RecursiveDNSClient
 )
 
 // GetResolver determines which DNS resolver to use based on configuration
@@ -188,6 +193,11 @@ func GetResolver(resolverType ResolverType, customAddress string, domain string)
 		// Look up the authoritative nameserver for the domain
 		return getAuthoritativeNameserver(domain)
 
+	case ResolverTypeRecursive:
+		// RecursiveDNSClient walks the delegation chain itself starting from
+		// the root hints, so there's no single upstream address to return
+		return "", nil
+
 	default:
 		return "", fmt.Errorf("unknown resolver type: %d", resolverType)
 	}
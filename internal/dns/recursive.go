@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rootHints is a small hard-coded set of root nameserver IPs, enough to get
+// a recursion started without depending on any external hints file
+var rootHints = []string{
+	"198.41.0.4:53",     // a.root-servers.net
+	"199.9.14.201:53",   // b.root-servers.net
+	"192.33.4.12:53",    // c.root-servers.net
+	"199.7.91.13:53",    // d.root-servers.net
+	"192.203.230.10:53", // e.root-servers.net
+}
+
+const (
+	numStartingServers = 3               // how many root hints to try before giving up
+	udpQueryTimeout    = 5 * time.Second // default per-query timeout, UDP and TCP-on-truncation alike
+	maxDepth           = 30              // guards against pathological delegation loops
+)
+
+// RecursiveDNSClient resolves A records by walking the delegation chain from
+// the root nameservers itself, rather than handing the query off to an
+// upstream recursive resolver like 8.8.8.8. This lets researchers see exactly
+// which authoritative servers are contacted along the way.
+type RecursiveDNSClient struct {
+	timeout time.Duration
+}
+
+// NewRecursiveDNSClient creates a new from-root recursive client
+func NewRecursiveDNSClient(timeout time.Duration) *RecursiveDNSClient {
+	if timeout <= 0 {
+		timeout = udpQueryTimeout
+	}
+	return &RecursiveDNSClient{timeout: timeout}
+}
+
+// Query resolves domain's A records by walking the delegation chain from the
+// root hints down to the authoritative nameserver
+func (c *RecursiveDNSClient) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	queryTime := time.Now()
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.RecursionDesired = false
+	// Request DNSSEC records with a large UDP bufsize so signed responses
+	// from the delegation chain aren't silently truncated
+	msg.SetEdns0(4096, true)
+
+	response, server, err := c.resolve(msg, c.startingServers(), 0)
+
+	result := &QueryResult{
+		Domain:    domain,
+		Response:  response,
+		Server:    server,
+		Error:     err,
+		QueryTime: queryTime,
+		Answers:   make([]string, 0),
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.RTT = time.Since(queryTime)
+	for _, answer := range response.Answer {
+		if a, ok := answer.(*dns.A); ok {
+			result.Answers = append(result.Answers, a.A.String())
+		}
+	}
+
+	return result, nil
+}
+
+func (c *RecursiveDNSClient) startingServers() []string {
+	n := numStartingServers
+	if n > len(rootHints) {
+		n = len(rootHints)
+	}
+	return rootHints[:n]
+}
+
+// resolve sends msg to each candidate server in turn, following NS referrals
+// from the Authority section until it gets an answer or runs out of
+// candidates. Errors from every candidate and every referral are aggregated
+// so a caller can see why a lookup failed, not just that it did.
+func (c *RecursiveDNSClient) resolve(msg *dns.Msg, candidates []string, depth int) (*dns.Msg, string, error) {
+	if depth > maxDepth {
+		return nil, "", fmt.Errorf("recursion depth exceeded %d levels resolving %s", maxDepth, msg.Question[0].Name)
+	}
+
+	var errs []error
+	for _, server := range candidates {
+		response, err := c.exchange(msg, server)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			continue
+		}
+
+		// An answer (or a definitive NXDOMAIN) means we're done
+		if len(response.Answer) > 0 || response.Rcode == dns.RcodeNameError {
+			return response, server, nil
+		}
+
+		next, referralErr := c.followReferral(response, depth)
+		if len(next) == 0 {
+			if referralErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", server, referralErr))
+			}
+			continue
+		}
+
+		result, referredServer, err := c.resolve(msg, next, depth+1)
+		if err == nil {
+			return result, referredServer, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, "", fmt.Errorf("no candidate nameserver could resolve %s: %w", msg.Question[0].Name, errors.Join(errs...))
+}
+
+// followReferral extracts the nameservers delegated in response's Authority
+// section and resolves each to an IP, using glue records from the Additional
+// section where present and recursing on glue-less NS names otherwise
+func (c *RecursiveDNSClient) followReferral(response *dns.Msg, depth int) ([]string, error) {
+	var nsNames []string
+	for _, rr := range response.Ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			nsNames = append(nsNames, ns.Ns)
+		}
+	}
+	if len(nsNames) == 0 {
+		return nil, nil
+	}
+
+	glue := make(map[string]string)
+	for _, rr := range response.Extra {
+		if a, ok := rr.(*dns.A); ok {
+			glue[strings.ToLower(a.Hdr.Name)] = a.A.String() + ":53"
+		}
+	}
+
+	var servers []string
+	var errs []error
+	for _, nsName := range nsNames {
+		if addr, ok := glue[strings.ToLower(nsName)]; ok {
+			servers = append(servers, addr)
+			continue
+		}
+
+		nsMsg := new(dns.Msg)
+		nsMsg.SetQuestion(nsName, dns.TypeA)
+		nsMsg.RecursionDesired = false
+		nsResponse, _, err := c.resolve(nsMsg, c.startingServers(), depth+1)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolving glue-less NS %s: %w", nsName, err))
+			continue
+		}
+		for _, answer := range nsResponse.Answer {
+			if a, ok := answer.(*dns.A); ok {
+				servers = append(servers, a.A.String()+":53")
+			}
+		}
+	}
+
+	if len(servers) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("referral named no resolvable nameservers"))
+	}
+	return servers, errors.Join(errs...)
+}
+
+// exchange sends msg to server over UDP, falling back to TCP if the response
+// comes back truncated
+func (c *RecursiveDNSClient) exchange(msg *dns.Msg, server string) (*dns.Msg, error) {
+	udpClient := &dns.Client{Net: "udp", Timeout: c.timeout, UDPSize: 4096}
+	response, _, err := udpClient.Exchange(msg, server)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Truncated {
+		tcpClient := &dns.Client{Net: "tcp", Timeout: c.timeout}
+		response, _, err = tcpClient.Exchange(msg, server)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// Close cleans up resources
+func (c *RecursiveDNSClient) Close() error {
+	return nil
+}
@@ -10,6 +10,12 @@ import (
 	"github.com/miekg/dns"
 )
 
+// Handler is an alias for miekg/dns's Handler interface, re-exported so
+// callers outside this package can type protocol server constructors
+// (which accept either a *Server or a *ForwardingHandler) without importing
+// miekg/dns directly.
+type Handler = dns.Handler
+
 // Server represents a DNS server that can listen on multiple protocols
 type Server struct {
 	domain     string
@@ -174,15 +180,17 @@ func (s *Server) GetStats() (uint64, time.Duration) {
 	return s.queryCount, time.Since(s.startTime)
 }
 
-// PlainDNSServer wraps the Server for plain DNS (UDP) operation
+// PlainDNSServer wraps a dns.Handler for plain DNS (UDP) operation.
+// The handler is typically a *Server, or a *ForwardingHandler when
+// out-of-zone queries should be relayed upstream instead of NXDOMAIN'd.
 type PlainDNSServer struct {
-	handler   *Server
+	handler   dns.Handler
 	udpServer *dns.Server
 	address   string
 }
 
 // NewPlainDNSServer creates a server that listens on UDP
-func NewPlainDNSServer(handler *Server, address string) *PlainDNSServer {
+func NewPlainDNSServer(handler dns.Handler, address string) *PlainDNSServer {
 	return &PlainDNSServer{
 		handler: handler,
 		address: address,
@@ -0,0 +1,37 @@
+// Package metrics registers the Prometheus collectors used to measure
+// per-protocol DNS overhead (query volume, latency, response size, and TLS
+// handshake cost), and serves them over a small /metrics HTTP endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// QueriesTotal counts DNS queries served, by protocol, query type, and response code
+var QueriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dns_queries_total",
+	Help: "Total number of DNS queries served, by protocol, query type, and response code",
+}, []string{"protocol", "qtype", "rcode"})
+
+// QueryDuration measures how long it takes to answer a query, by protocol
+var QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dns_query_duration_seconds",
+	Help:    "Time taken to answer a DNS query, by protocol",
+	Buckets: prometheus.DefBuckets,
+}, []string{"protocol"})
+
+// ResponseBytes measures the wire-format size of DNS responses, by protocol
+var ResponseBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dns_response_bytes",
+	Help:    "Size of DNS responses in bytes, by protocol",
+	Buckets: prometheus.ExponentialBuckets(32, 2, 10),
+}, []string{"protocol"})
+
+// TLSHandshakeDuration measures TLS handshake latency on the encrypted
+// listeners (DoH/DoT/DoQ), by protocol
+var TLSHandshakeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "tls_handshake_duration_seconds",
+	Help:    "Time taken to complete a TLS handshake, by protocol",
+	Buckets: prometheus.DefBuckets,
+}, []string{"protocol"})
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultAddr is where the metrics server listens if the caller doesn't
+// configure one. It's loopback-only since this is a research tool, not a
+// production exporter.
+const DefaultAddr = "127.0.0.1:9153"
+
+// Server exposes the registered collectors over Prometheus's text exposition format
+type Server struct {
+	httpServer *http.Server
+	address    string
+}
+
+// NewServer creates a metrics server bound to address. An empty address
+// falls back to DefaultAddr.
+func NewServer(address string) *Server {
+	if address == "" {
+		address = DefaultAddr
+	}
+	return &Server{address: address}
+}
+
+// Start begins serving /metrics. This blocks until the server stops.
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	s.httpServer = &http.Server{
+		Addr:    s.address,
+		Handler: mux,
+	}
+
+	fmt.Printf("Starting metrics server on %s (/metrics)\n", s.address)
+
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to start metrics server: %w", err)
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the metrics server
+func (s *Server) Stop() error {
+	if s.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.httpServer.Shutdown(ctx)
+	}
+	return nil
+}
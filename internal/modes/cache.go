@@ -0,0 +1,310 @@
+package modes
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheKey identifies a cached query by question name/type, mirroring
+// dns.ResponseCache's server-side cache key (minus qclass, since every
+// DNSClient implementation here only ever queries IN).
+type cacheKey struct {
+	qname string
+	qtype uint16
+}
+
+func cacheKeyFor(domain string, qtype uint16) cacheKey {
+	return cacheKey{qname: strings.ToLower(dns.Fqdn(domain)), qtype: qtype}
+}
+
+// cacheEntry holds a cached response plus enough bookkeeping to age out TTLs
+type cacheEntry struct {
+	msg        *dns.Msg
+	insertedAt time.Time
+	ttl        time.Duration // minimum TTL across the response at insertion time
+	listElem   *list.Element
+}
+
+// CacheStats reports cache hit/miss/eviction counters
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+// CachingClient decorates any DNSClient with a bounded, TTL-aware LRU cache
+// keyed by (qname, qtype), so repeated beacon queries for the same name are
+// answered locally instead of re-sent over the wire. It honors the
+// DNSClient interface itself, so it composes transparently with any other
+// client (plain, DoH, DoT, DoQ).
+//
+// Negative responses (NXDOMAIN, and NODATA where Rcode is success but the
+// answer section is empty) are cached per RFC 2308 §5 for
+// min(SOA.MINIMUM, SOA.TTL), capped at negativeTTLCeiling, since those
+// carry no answer-section TTL of their own.
+type CachingClient struct {
+	next DNSClient
+
+	mu                 sync.Mutex
+	entries            map[cacheKey]*cacheEntry
+	order              *list.List // front = most recently used
+	maxEntries         int
+	negativeTTLCeiling time.Duration
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewCachingClient wraps next with a cache bounded to maxEntries entries.
+// negativeTTLCeiling bounds how long NXDOMAIN/NODATA responses are kept
+// (RFC 2308's own SOA-derived TTL is used if it's shorter). maxEntries <= 0
+// defaults to 10000, negativeTTLCeiling <= 0 defaults to 5 minutes.
+func NewCachingClient(next DNSClient, maxEntries int, negativeTTLCeiling time.Duration) *CachingClient {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	if negativeTTLCeiling <= 0 {
+		negativeTTLCeiling = 5 * time.Minute
+	}
+
+	return &CachingClient{
+		next:               next,
+		entries:            make(map[cacheKey]*cacheEntry),
+		order:              list.New(),
+		maxEntries:         maxEntries,
+		negativeTTLCeiling: negativeTTLCeiling,
+	}
+}
+
+// Query answers domain from cache when a live, unexpired entry exists;
+// otherwise it delegates to next and caches a cacheable result before
+// returning it.
+func (c *CachingClient) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	queryTime := time.Now()
+	key := cacheKeyFor(domain, dns.TypeA)
+
+	if cached, ok := c.get(key); ok {
+		cached.Id = dns.Id()
+		return &QueryResult{
+			Domain:    domain,
+			Response:  cached,
+			RTT:       0,
+			QueryTime: queryTime,
+			Answers:   answersFrom(cached),
+			CacheHit:  true,
+		}, nil
+	}
+
+	result, err := c.next.Query(ctx, domain)
+	if err == nil && result.Response != nil {
+		c.set(key, result.Response)
+	}
+	return result, err
+}
+
+// Close closes the wrapped client. The cache itself holds no resources that
+// need releasing.
+func (c *CachingClient) Close() error {
+	return c.next.Close()
+}
+
+// Ensure CachingClient implements the DNSClient interface
+var _ DNSClient = (*CachingClient)(nil)
+
+// get looks up a cached response, decrementing each RR's TTL by the time
+// elapsed since insertion. A response whose remaining TTL has reached zero
+// is treated as a miss and evicted.
+func (c *CachingClient) get(key cacheKey) (*dns.Msg, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	elapsed := time.Since(entry.insertedAt)
+	remaining := entry.ttl - elapsed
+	if remaining <= 0 {
+		c.removeLocked(key, entry)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(entry.listElem)
+	c.hits++
+
+	return ageMessage(entry.msg, elapsed), true
+}
+
+// set stores msg, deriving its expiry from the minimum TTL across the
+// answer, authority and additional sections for a positive response, or the SOA-derived RFC 2308 negative TTL
+// (capped at negativeTTLCeiling) for NXDOMAIN/NODATA. Responses that are
+// neither (e.g. SERVFAIL) aren't cached.
+func (c *CachingClient) set(key cacheKey, msg *dns.Msg) {
+	ttl := negativeTTL(msg, c.negativeTTLCeiling)
+	if msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0 {
+		ttl = minRRTTL(msg)
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.entries[key]; ok {
+		c.order.MoveToFront(existing.listElem)
+		existing.msg = msg.Copy()
+		existing.insertedAt = time.Now()
+		existing.ttl = ttl
+		return
+	}
+
+	for len(c.entries) >= c.maxEntries {
+		c.evictOldestLocked()
+	}
+
+	entry := &cacheEntry{
+		msg:        msg.Copy(),
+		insertedAt: time.Now(),
+		ttl:        ttl,
+	}
+	entry.listElem = c.order.PushFront(key)
+	c.entries[key] = entry
+}
+
+func (c *CachingClient) evictOldestLocked() {
+	oldest := c.order.Back()
+	if oldest == nil {
+		return
+	}
+	key := oldest.Value.(cacheKey)
+	c.removeLocked(key, c.entries[key])
+	c.evictions++
+}
+
+func (c *CachingClient) removeLocked(key cacheKey, entry *cacheEntry) {
+	if entry != nil && entry.listElem != nil {
+		c.order.Remove(entry.listElem)
+	}
+	delete(c.entries, key)
+}
+
+// GetStats returns a snapshot of cache hit/miss/eviction counters
+func (c *CachingClient) GetStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries),
+	}
+}
+
+// negativeTTL returns how long a negative response (NXDOMAIN, or NODATA:
+// success with an empty answer section) should be cached, per RFC 2308 §5:
+// the minimum of the authority section's SOA record's own TTL and its
+// MINIMUM field, capped at ceiling. Returns 0 for any other rcode.
+func negativeTTL(msg *dns.Msg, ceiling time.Duration) time.Duration {
+	isNegative := msg.Rcode == dns.RcodeNameError ||
+		(msg.Rcode == dns.RcodeSuccess && len(msg.Answer) == 0)
+	if !isNegative {
+		return 0
+	}
+
+	for _, rr := range msg.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		ttl := soa.Minttl
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+		negTTL := time.Duration(ttl) * time.Second
+		if negTTL > ceiling {
+			negTTL = ceiling
+		}
+		return negTTL
+	}
+
+	// No SOA present to bound the negative TTL from; fall back to the
+	// ceiling rather than refusing to cache it at all.
+	return ceiling
+}
+
+// minRRTTL returns the smallest TTL across the answer/authority/additional
+// sections, which bounds how long the whole response can be safely cached
+func minRRTTL(msg *dns.Msg) time.Duration {
+	var min uint32
+	found := false
+
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				// The EDNS0 OPT pseudo-record repurposes Hdr.Ttl to carry
+				// extended RCODE/flags, not a real TTL; folding it into the
+				// minimum would cache every EDNS response for 0 seconds.
+				continue
+			}
+			ttl := rr.Header().Ttl
+			if !found || ttl < min {
+				min = ttl
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return 0
+	}
+	return time.Duration(min) * time.Second
+}
+
+// ageMessage returns a deep copy of msg with every RR's TTL reduced by
+// elapsed, floored at zero so a response is never returned with a negative
+// TTL.
+func ageMessage(msg *dns.Msg, elapsed time.Duration) *dns.Msg {
+	aged := msg.Copy()
+	elapsedSecs := uint32(elapsed / time.Second)
+
+	for _, section := range [][]dns.RR{aged.Answer, aged.Ns, aged.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				// Not a real TTL (see minRRTTL); leave the OPT record alone.
+				continue
+			}
+			hdr := rr.Header()
+			if hdr.Ttl > elapsedSecs {
+				hdr.Ttl -= elapsedSecs
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+
+	return aged
+}
+
+// answersFrom extracts IPv4 answers from msg, matching the extraction every
+// DNSClient.Query implementation does inline.
+func answersFrom(msg *dns.Msg) []string {
+	answers := make([]string, 0)
+	for _, answer := range msg.Answer {
+		if a, ok := answer.(*dns.A); ok {
+			answers = append(answers, a.A.String())
+		}
+	}
+	return answers
+}
@@ -2,8 +2,10 @@ package modes
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/faanross/dns-encryption-simulator/internal/control"
 	"github.com/miekg/dns"
 )
 
@@ -22,8 +24,14 @@ var (
 
 // PlainDNSClientAdapter adapts the plain DNS client to the DNSClient interface
 type PlainDNSClientAdapter struct {
-	client   *dns.Client
-	resolver string
+	client    *dns.Client
+	tcpClient *dns.Client
+	resolver  string
+
+	controlClient *control.Client
+	agentID       string
+
+	disableTCPRetry bool
 }
 
 // NewPlainDNSClientAdapter creates an adapter for plain DNS
@@ -33,17 +41,54 @@ func NewPlainDNSClientAdapter(resolver string, timeout time.Duration) *PlainDNSC
 		Timeout: timeout,
 		UDPSize: 4096,
 	}
+	tcpClient := &dns.Client{
+		Net:     "tcp",
+		Timeout: timeout,
+	}
 
 	return &PlainDNSClientAdapter{
-		client:   client,
-		resolver: resolver,
+		client:    client,
+		tcpClient: tcpClient,
+		resolver:  resolver,
 	}
 }
 
+// EnableControlPlane wires client into future Query calls, pre-declaring
+// each outgoing FQDN under agentID (see AgentConfig's ControlPlaneAddr and
+// AgentID) before it's sent, so the server can join its plan against what
+// it actually observes. The default, a nil client, leaves Query sending
+// queries without pre-declaring them.
+func (c *PlainDNSClientAdapter) EnableControlPlane(client *control.Client, agentID string) {
+	c.controlClient = client
+	c.agentID = agentID
+}
+
+// DisableTCPRetry turns off the automatic TCP retry Query otherwise performs
+// when a UDP response comes back truncated (TC bit set), mirroring
+// Tailscale's DisableDNSForwarderTCPRetries. Leave enabled (the default) to
+// see the real, untruncated answer; disable it to observe raw truncation
+// behavior instead.
+func (c *PlainDNSClientAdapter) DisableTCPRetry() {
+	c.disableTCPRetry = true
+}
+
 // Query sends a plain DNS query
 func (c *PlainDNSClientAdapter) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	fqdn := dns.Fqdn(domain)
+
+	if c.controlClient != nil {
+		// Reported synchronously and before the query is sent, so the plan
+		// is always registered before Observe can possibly see the matching
+		// query arrive server-side; a background goroutine here would race
+		// the two, and an unplanned-looking query would corrupt the very
+		// planned-vs-observed report this exists to produce.
+		if err := c.controlClient.ReportQuery(c.agentID, fqdn, "plain"); err != nil {
+			fmt.Printf("[control] failed to report query plan: %v\n", err)
+		}
+	}
+
 	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.SetQuestion(fqdn, dns.TypeA)
 	msg.RecursionDesired = true
 
 	queryTime := time.Now()
@@ -67,6 +112,18 @@ func (c *PlainDNSClientAdapter) Query(ctx context.Context, domain string) (*Quer
 		return result, nil
 	}
 
+	if response.Truncated && !c.disableTCPRetry {
+		tcpResponse, tcpRTT, tcpErr := c.tcpClient.Exchange(msg, c.resolver)
+		result.RetriedTCP = true
+		result.TCPRTT = tcpRTT
+		if tcpErr != nil {
+			result.Error = fmt.Errorf("UDP response truncated, TCP retry failed: %w", tcpErr)
+			return result, result.Error
+		}
+		response = tcpResponse
+		result.Response = response
+	}
+
 	for _, answer := range response.Answer {
 		if a, ok := answer.(*dns.A); ok {
 			result.Answers = append(result.Answers, a.A.String())
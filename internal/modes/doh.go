@@ -4,28 +4,75 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
 )
 
+// DoHMethod selects how a DoHClient puts the DNS query on the wire.
+type DoHMethod int
+
+const (
+	// MethodPOST sends the DNS message as the request body (RFC 8484 §4.1).
+	// This is the default and matches all earlier DoHClient behavior.
+	MethodPOST DoHMethod = iota
+
+	// MethodGET base64url-encodes the DNS message into a `?dns=` query
+	// parameter (RFC 8484 §4.1's GET form), which intermediate HTTP caches
+	// can cache by URL the way they can't a POST body.
+	MethodGET
+)
+
+// DoHOptions controls method and HTTP version selection for a DoHClient.
+// The zero value (MethodPOST over HTTP/2) matches NewDoHClient's behavior.
+type DoHOptions struct {
+	// Method selects POST (default) or GET per RFC 8484 §4.1.
+	Method DoHMethod
+
+	// PreferH3, if set, races an HTTP/3 request against the HTTP/2 one and
+	// uses whichever completes first (Happy-Eyeballs style), so a slow or
+	// blocked QUIC path doesn't stall the query.
+	PreferH3 bool
+
+	// ForceH3, if set, sends only over HTTP/3 and skips HTTP/2 entirely.
+	// Takes precedence over PreferH3.
+	ForceH3 bool
+}
+
 // DoHClient performs DNS-over-HTTPS queries
 type DoHClient struct {
 	serverURL          string // Full URL to DoH endpoint
 	httpClient         *http.Client
+	h3Client           *http.Client // nil unless PreferH3 or ForceH3 is set
 	timeout            time.Duration
 	insecureSkipVerify bool
+	enablePadding      bool
+	method             DoHMethod
+	preferH3           bool
+	forceH3            bool
 }
 
-// NewDoHClient creates a new DNS-over-HTTPS client
-func NewDoHClient(serverURL string, timeout time.Duration, insecureSkipVerify bool) *DoHClient {
+// NewDoHClient creates a new DNS-over-HTTPS client using RFC 8484 POST over
+// HTTP/2. rootCAs may be nil, in which case the system trust store is used.
+func NewDoHClient(serverURL string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool) *DoHClient {
+	return NewDoHClientWithOptions(serverURL, timeout, insecureSkipVerify, rootCAs, enablePadding, DoHOptions{})
+}
+
+// NewDoHClientWithOptions is NewDoHClient with explicit control over the
+// RFC 8484 method (POST/GET) and HTTP/3 usage (see DoHOptions).
+func NewDoHClientWithOptions(serverURL string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool, opts DoHOptions) *DoHClient {
 	// Configure TLS
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: insecureSkipVerify,
 		MinVersion:         tls.VersionTLS12, // Require TLS 1.2 or higher
+		RootCAs:            rootCAs,
 	}
 
 	// Create HTTP client with TLS and timeout
@@ -41,12 +88,27 @@ func NewDoHClient(serverURL string, timeout time.Duration, insecureSkipVerify bo
 		},
 	}
 
-	return &DoHClient{
+	c := &DoHClient{
 		serverURL:          serverURL,
 		httpClient:         httpClient,
 		timeout:            timeout,
 		insecureSkipVerify: insecureSkipVerify,
+		enablePadding:      enablePadding,
+		method:             opts.Method,
+		preferH3:           opts.PreferH3,
+		forceH3:            opts.ForceH3,
+	}
+
+	if opts.PreferH3 || opts.ForceH3 {
+		c.h3Client = &http.Client{
+			Timeout: timeout,
+			Transport: &http3.RoundTripper{
+				TLSClientConfig: tlsConfig.Clone(),
+			},
+		}
 	}
+
+	return c
 }
 
 // Query sends a DNS query over HTTPS
@@ -56,6 +118,10 @@ func (c *DoHClient) Query(ctx context.Context, domain string) (*QueryResult, err
 	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
 	msg.RecursionDesired = true
 
+	if c.enablePadding {
+		PadMessage(msg, QueryPaddingBlockSize)
+	}
+
 	// Pack the DNS message into wire format (binary)
 	// This is the actual DNS protocol message, just transported over HTTPS
 	wireFormat, err := msg.Pack()
@@ -66,19 +132,7 @@ func (c *DoHClient) Query(ctx context.Context, domain string) (*QueryResult, err
 	// Record query start time
 	queryTime := time.Now()
 
-	// Create HTTP POST request
-	// RFC 8484 specifies POST method with application/dns-message content type
-	req, err := http.NewRequestWithContext(ctx, "POST", c.serverURL, bytes.NewReader(wireFormat))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	// Set required headers for DoH
-	req.Header.Set("Content-Type", "application/dns-message")
-	req.Header.Set("Accept", "application/dns-message")
-
-	// Send the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(ctx, wireFormat)
 	if err != nil {
 		return &QueryResult{
 			Domain:    domain,
@@ -143,9 +197,109 @@ func (c *DoHClient) Query(ctx context.Context, domain string) (*QueryResult, err
 	return result, nil
 }
 
+// send dispatches wireFormat per c's method/transport settings: ForceH3
+// skips HTTP/2 entirely, PreferH3 races both transports and returns
+// whichever answers first, and otherwise it's a plain HTTP/2 request.
+func (c *DoHClient) send(ctx context.Context, wireFormat []byte) (*http.Response, error) {
+	if c.forceH3 {
+		req, err := c.buildRequest(ctx, wireFormat)
+		if err != nil {
+			return nil, err
+		}
+		return c.h3Client.Do(req)
+	}
+
+	if c.preferH3 {
+		return c.raceH2H3(ctx, wireFormat)
+	}
+
+	req, err := c.buildRequest(ctx, wireFormat)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// raceH2H3 sends the same query over HTTP/2 and HTTP/3 concurrently and
+// returns whichever response arrives first (Happy-Eyeballs style). If the
+// winner errored, the other transport's result is used instead rather than
+// failing the query over one bad transport. The loser isn't proactively
+// canceled — both requests share ctx's own deadline — since canceling it
+// would require a context distinct from the winner's, and tearing down the
+// winner's context here would invalidate its still-unread response body.
+func (c *DoHClient) raceH2H3(ctx context.Context, wireFormat []byte) (*http.Response, error) {
+	type outcome struct {
+		resp *http.Response
+		err  error
+	}
+	results := make(chan outcome, 2)
+
+	race := func(client *http.Client) {
+		req, err := c.buildRequest(ctx, wireFormat)
+		if err != nil {
+			results <- outcome{err: err}
+			return
+		}
+		resp, err := client.Do(req)
+		results <- outcome{resp: resp, err: err}
+	}
+
+	go race(c.httpClient)
+	go race(c.h3Client)
+
+	first := <-results
+	if first.err == nil {
+		// Drain the loser's result in the background so race()'s goroutine
+		// doesn't leak, closing its body if it did arrive.
+		go func() {
+			if second := <-results; second.resp != nil {
+				second.resp.Body.Close()
+			}
+		}()
+		return first.resp, nil
+	}
+
+	second := <-results
+	return second.resp, second.err
+}
+
+// buildRequest encodes wireFormat as a GET or POST request per RFC 8484
+// §4.1, depending on c.method.
+func (c *DoHClient) buildRequest(ctx context.Context, wireFormat []byte) (*http.Request, error) {
+	if c.method == MethodGET {
+		u, err := url.Parse(c.serverURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DoH server URL %q: %w", c.serverURL, err)
+		}
+		q := u.Query()
+		q.Set("dns", base64.RawURLEncoding.EncodeToString(wireFormat))
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		}
+		req.Header.Set("Accept", "application/dns-message")
+		return req, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.serverURL, bytes.NewReader(wireFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	return req, nil
+}
+
 // Close cleans up resources
 func (c *DoHClient) Close() error {
 	c.httpClient.CloseIdleConnections()
+	if c.h3Client != nil {
+		if rt, ok := c.h3Client.Transport.(*http3.RoundTripper); ok {
+			rt.Close()
+		}
+	}
 	return nil
 }
 
@@ -159,4 +313,31 @@ type QueryResult struct {
 	Error     error
 	Answers   []string
 	QueryTime time.Time
+
+	// HandshakeRTT is how long establishing the underlying connection took,
+	// zero when Reused is true. Lets callers split DoT/DoQ latency into
+	// "paid for the handshake" vs. "paid for the query" instead of RTT
+	// lumping both together.
+	HandshakeRTT time.Duration
+
+	// Reused reports whether this query ran on a pooled connection left
+	// over from an earlier query, rather than one dialed fresh for it.
+	// Always false for Plain DNS and DoH, which don't pool connections here.
+	Reused bool
+
+	// CacheHit reports whether this result was answered locally by a
+	// CachingClient instead of being sent to the wrapped DNSClient. Always
+	// false unless the client in use is wrapped with NewCachingClient.
+	CacheHit bool
+
+	// RetriedTCP reports whether PlainDNSClientAdapter retried this query
+	// over TCP after the UDP response came back truncated (TC bit set).
+	// Always false for every other client, and for plain DNS with the TCP
+	// retry disabled via DisableTCPRetry.
+	RetriedTCP bool
+
+	// TCPRTT is the round-trip time of the TCP retry, set only when
+	// RetriedTCP is true. RTT still holds the (truncated) UDP exchange's
+	// round-trip time, so callers can see the cost of both legs.
+	TCPRTT time.Duration
 }
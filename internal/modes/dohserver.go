@@ -0,0 +1,186 @@
+package modes
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+
+	ourtls "github.com/faanross/dns-encryption-simulator/internal/tls"
+)
+
+// DoHServer is a DNS-over-HTTPS gateway: it terminates RFC 8484 (accepting
+// both POST application/dns-message and GET ?dns= base64url) over HTTPS,
+// then answers each query by forwarding the question's domain through a
+// configurable backend DNSClient (plain, DoT, DoH, or DoQ) instead of
+// consulting a local zone. This is what lets a student chain
+// client -> DoHServer -> upstream the way internal/dns.DoHServer's
+// ForwardingHandler chains dns.Handler -> upstream, but driven entirely by
+// the same DNSClient abstraction Beacon and the cmd/agent clients use.
+type DoHServer struct {
+	backend  DNSClient
+	address  string
+	certFile string
+	keyFile  string
+
+	httpServer *http.Server
+}
+
+// NewDoHServer creates a DoHServer that answers every query by forwarding
+// its domain to backend.
+func NewDoHServer(backend DNSClient, address, certFile, keyFile string) *DoHServer {
+	return &DoHServer{
+		backend:  backend,
+		address:  address,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// Start begins listening for DoH requests. It blocks until Stop is called.
+func (s *DoHServer) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dns-query", s.handleDoHRequest)
+
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	s.httpServer = &http.Server{
+		Addr:         s.address,
+		Handler:      mux,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	rawListener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+	timingListener := ourtls.NewTimingListener(rawListener, tlsConfig, "doh-gateway")
+
+	fmt.Printf("Starting DoH gateway on %s (HTTPS), forwarding to backend\n", s.address)
+
+	if err := s.httpServer.Serve(timingListener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("failed to start HTTPS server: %w", err)
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server
+func (s *DoHServer) Stop() error {
+	if s.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.httpServer.Shutdown(ctx)
+	}
+	return nil
+}
+
+// handleDoHRequest unpacks the wire-format query, forwards its domain to
+// s.backend, and writes back a wire-format response built from the
+// backend's answer.
+func (s *DoHServer) handleDoHRequest(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); ct != "application/dns-message" {
+			http.Error(w, "Content-Type must be application/dns-message", http.StatusBadRequest)
+			return
+		}
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Failed to read request body: %v", err)
+			http.Error(w, "Failed to read request", http.StatusBadRequest)
+			return
+		}
+
+	case http.MethodGet:
+		// RFC 8484 §4.1.1: the wire-format query is base64url (no padding)
+		// encoded into the "dns" query parameter
+		encoded := r.URL.Query().Get("dns")
+		if encoded == "" {
+			http.Error(w, "missing dns query parameter", http.StatusBadRequest)
+			return
+		}
+		body, err = base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			log.Printf("Failed to decode dns query parameter: %v", err)
+			http.Error(w, "invalid dns query parameter", http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, "Only GET and POST methods supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(body); err != nil {
+		log.Printf("Failed to unpack DNS message: %v", err)
+		http.Error(w, "Invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+
+	if len(query.Question) == 0 {
+		s.writeResponse(w, response)
+		return
+	}
+
+	domain := query.Question[0].Name
+	result, err := s.backend.Query(r.Context(), domain)
+	if err != nil {
+		log.Printf("backend query for %q failed: %v", domain, err)
+		response.SetRcode(query, dns.RcodeServerFailure)
+		s.writeResponse(w, response)
+		return
+	}
+
+	if result.Response != nil {
+		response.Answer = result.Response.Answer
+		response.Ns = result.Response.Ns
+		response.Extra = result.Response.Extra
+		response.Rcode = result.Response.Rcode
+	}
+
+	s.writeResponse(w, response)
+}
+
+// writeResponse packs response into wire format and writes it, advertising
+// the answer's TTL so an HTTP cache in front of us (or the browser) doesn't
+// hold it longer than the DNS response itself is valid for.
+func (s *DoHServer) writeResponse(w http.ResponseWriter, response *dns.Msg) {
+	responseBytes, err := response.Pack()
+	if err != nil {
+		log.Printf("Failed to pack DNS response: %v", err)
+		http.Error(w, "Failed to create response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/dns-message")
+	if ttl := minRRTTL(response); ttl > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl.Seconds())))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBytes)
+}
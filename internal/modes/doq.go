@@ -0,0 +1,307 @@
+package modes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQPoolOptions controls the persistent connection pool backing a
+// DoQClient, mirroring DoTPoolOptions. The zero value is replaced with
+// sensible defaults by NewDoQClient.
+type DoQPoolOptions struct {
+	// IdleTimeout is how long a pooled QUIC connection is kept warm with no
+	// queries on it before it's closed. Default: 30s.
+	IdleTimeout time.Duration
+
+	// MaxInFlight is how many concurrent streams a single QUIC connection
+	// will carry before a new connection is dialed. Default: 16 (QUIC
+	// streams are cheap, so we allow deeper pipelining than DoT).
+	MaxInFlight int
+}
+
+// DoQClient performs DNS-over-QUIC queries per RFC 9250
+type DoQClient struct {
+	addr               string // Server address (IP:port)
+	serverName         string // SNI for TLS handshake
+	timeout            time.Duration
+	insecureSkipVerify bool
+	enablePadding      bool
+	tlsConfig          *tls.Config
+
+	pool *doqConnPool
+}
+
+// NewDoQClient creates a new DNS-over-QUIC client with default pooling
+// behavior (see DoQPoolOptions). rootCAs may be nil, in which case the
+// system trust store is used.
+func NewDoQClient(addr string, serverName string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool) *DoQClient {
+	return NewDoQClientWithPool(addr, serverName, timeout, insecureSkipVerify, rootCAs, enablePadding, DoQPoolOptions{})
+}
+
+// NewDoQClientWithPool is NewDoQClient with explicit control over idle
+// timeout and the number of concurrent streams per QUIC connection.
+func NewDoQClientWithPool(addr string, serverName string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool, opts DoQPoolOptions) *DoQClient {
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         []string{"doq"},
+		RootCAs:            rootCAs,
+		ClientSessionCache: tls.NewLRUClientSessionCache(32),
+	}
+
+	c := &DoQClient{
+		addr:               addr,
+		serverName:         serverName,
+		timeout:            timeout,
+		insecureSkipVerify: insecureSkipVerify,
+		enablePadding:      enablePadding,
+		tlsConfig:          tlsConfig,
+	}
+	c.pool = newDoQConnPool(c.dial, opts)
+	return c
+}
+
+// dial opens a fresh pooled QUIC connection to key.addr, timing the
+// handshake so Query can attribute latency to connection setup vs. the
+// query itself.
+func (c *DoQClient) dial(ctx context.Context, key poolKey) (*doqPooledConn, time.Duration, error) {
+	start := time.Now()
+	conn, err := quic.DialAddr(ctx, key.addr, c.tlsConfig, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to dial QUIC: %w", err)
+	}
+	return newDoqPooledConn(conn), time.Since(start), nil
+}
+
+// Query sends a DNS query over QUIC, reusing a pooled connection with spare
+// stream capacity for this destination, or dialing (and TLS-handshaking) a
+// new one if none is available.
+func (c *DoQClient) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	queryTime := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	key := poolKey{addr: c.addr, serverName: c.serverName}
+	pc, reused, handshakeRTT, err := c.pool.acquire(ctx, key)
+
+	result := &QueryResult{
+		Domain:       domain,
+		Server:       c.addr,
+		QueryTime:    queryTime,
+		Answers:      make([]string, 0),
+		HandshakeRTT: handshakeRTT,
+		Reused:       reused,
+	}
+
+	if err != nil {
+		result.Error = err
+		return result, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.RecursionDesired = true
+	msg.Id = 0 // RFC 9250 §4.2.1: DoQ queries MUST set the message ID to 0
+
+	if c.enablePadding {
+		PadMessage(msg, QueryPaddingBlockSize)
+	}
+
+	response, err := pc.exchange(ctx, msg)
+	result.RTT = time.Since(queryTime)
+
+	if err != nil {
+		result.Error = err
+		return result, err
+	}
+	result.Response = response
+
+	for _, answer := range response.Answer {
+		if a, ok := answer.(*dns.A); ok {
+			result.Answers = append(result.Answers, a.A.String())
+		}
+	}
+
+	return result, nil
+}
+
+// Close drains and closes every pooled QUIC connection.
+func (c *DoQClient) Close() error {
+	return c.pool.Close()
+}
+
+// Ensure DoQClient implements the DNSClient interface
+var _ DNSClient = (*DoQClient)(nil)
+
+// doqConnPool mirrors dotConnPool: persistent QUIC connections keyed by
+// (addr, serverName), reused across queries until idle too long or already
+// carrying MaxInFlight concurrent streams, in which case a fresh connection
+// (and TLS handshake) is dialed.
+type doqConnPool struct {
+	mu          sync.Mutex
+	conns       map[poolKey][]*doqPooledConn
+	dial        func(ctx context.Context, key poolKey) (*doqPooledConn, time.Duration, error)
+	idleTimeout time.Duration
+	maxInFlight int32
+}
+
+func newDoQConnPool(dial func(ctx context.Context, key poolKey) (*doqPooledConn, time.Duration, error), opts DoQPoolOptions) *doqConnPool {
+	idleTimeout := opts.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = 30 * time.Second
+	}
+	maxInFlight := opts.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 16
+	}
+
+	return &doqConnPool{
+		conns:       make(map[poolKey][]*doqPooledConn),
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		maxInFlight: int32(maxInFlight),
+	}
+}
+
+// acquire returns a pooled connection for key with room for another stream,
+// reusing one if available and dialing a fresh one otherwise. The returned
+// bool reports whether the connection was reused.
+func (p *doqConnPool) acquire(ctx context.Context, key poolKey) (*doqPooledConn, bool, time.Duration, error) {
+	p.mu.Lock()
+	bucket := p.conns[key]
+	live := bucket[:0]
+	var chosen *doqPooledConn
+	for _, pc := range bucket {
+		if pc.isDead() || pc.idleSince() > p.idleTimeout {
+			pc.close()
+			continue
+		}
+		live = append(live, pc)
+		if chosen == nil && pc.load() < p.maxInFlight {
+			chosen = pc
+		}
+	}
+	p.conns[key] = live
+	p.mu.Unlock()
+
+	if chosen != nil {
+		return chosen, true, 0, nil
+	}
+
+	pc, handshakeRTT, err := p.dial(ctx, key)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	p.mu.Lock()
+	p.conns[key] = append(p.conns[key], pc)
+	p.mu.Unlock()
+
+	return pc, false, handshakeRTT, nil
+}
+
+// Close drains and closes every pooled connection.
+func (p *doqConnPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, bucket := range p.conns {
+		for _, pc := range bucket {
+			pc.close()
+		}
+		delete(p.conns, key)
+	}
+	return nil
+}
+
+// doqPooledConn wraps a QUIC connection. Unlike DoT, no reader-loop/ID
+// matching is needed: each query gets its own QUIC stream, so the transport
+// itself multiplexes concurrent queries (RFC 9250 §5.1).
+type doqPooledConn struct {
+	connLifetime
+	conn quic.Connection
+
+	closeOnce sync.Once
+}
+
+func newDoqPooledConn(conn quic.Connection) *doqPooledConn {
+	pc := &doqPooledConn{conn: conn}
+	pc.touch()
+	return pc
+}
+
+// exchange opens its own QUIC stream for msg, so it can run concurrently
+// with other queries sharing pc.
+func (pc *doqPooledConn) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	pc.acquireSlot()
+	defer pc.releaseSlot()
+
+	wireFormat, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack DNS message: %w", err)
+	}
+
+	stream, err := pc.conn.OpenStreamSync(ctx)
+	if err != nil {
+		pc.close()
+		return nil, fmt.Errorf("failed to open QUIC stream: %w", err)
+	}
+	defer stream.Close()
+
+	// RFC 9250 §4.2: 2-byte length prefix followed by the wire-format message
+	lengthPrefix := make([]byte, 2)
+	binary.BigEndian.PutUint16(lengthPrefix, uint16(len(wireFormat)))
+
+	if _, err := stream.Write(append(lengthPrefix, wireFormat...)); err != nil {
+		pc.close()
+		return nil, fmt.Errorf("failed to write query: %w", err)
+	}
+
+	// Signal we're done sending, per RFC 9250 §4.2
+	stream.Close()
+
+	// A read failure here usually means the QUIC connection itself went bad
+	// (the peer reset it, or it died mid-response), not just this one
+	// stream — so mark pc dead like the OpenStreamSync/Write failures above
+	// do, rather than leaving a broken connection in the pool for the next
+	// query to pick up and fail against again.
+	respLengthBuf := make([]byte, 2)
+	if _, err := io.ReadFull(stream, respLengthBuf); err != nil {
+		pc.close()
+		return nil, fmt.Errorf("failed to read response length: %w", err)
+	}
+	respLength := binary.BigEndian.Uint16(respLengthBuf)
+
+	respBuf := make([]byte, respLength)
+	if _, err := io.ReadFull(stream, respBuf); err != nil {
+		pc.close()
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(respBuf); err != nil {
+		return nil, fmt.Errorf("failed to unpack DNS response: %w", err)
+	}
+
+	pc.touch()
+	return response, nil
+}
+
+func (pc *doqPooledConn) close() error {
+	var err error
+	pc.closeOnce.Do(func() {
+		pc.markDead()
+		err = pc.conn.CloseWithError(0, "")
+	})
+	return err
+}
@@ -2,29 +2,66 @@ package modes
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/faanross/dns-encryption-simulator/internal/control"
 	"github.com/miekg/dns"
 )
 
+// DoTPoolOptions controls the persistent connection pool backing a
+// DoTClient. The zero value is replaced with sensible defaults by
+// NewDoTClient.
+type DoTPoolOptions struct {
+	// IdleTimeout is how long a pooled connection is kept warm with no
+	// queries on it before it's closed. Default: 30s.
+	IdleTimeout time.Duration
+
+	// MaxInFlight is how many outstanding pipelined queries (RFC 7766) a
+	// single connection will carry before a new one is dialed. Default: 8.
+	MaxInFlight int
+}
+
 // DoTClient performs DNS-over-TLS queries
 type DoTClient struct {
 	serverAddr         string // Server address (IP:port)
 	tlsServerName      string // SNI for TLS handshake
 	timeout            time.Duration
 	insecureSkipVerify bool
+	enablePadding      bool
 	client             *dns.Client
+
+	pool *dotConnPool
+
+	controlClient *control.Client
+	agentID       string
+}
+
+// NewDoTClient creates a new DNS-over-TLS client with default pooling
+// behavior (see DoTPoolOptions). rootCAs may be nil, in which case the
+// system trust store is used.
+func NewDoTClient(serverAddr string, tlsServerName string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool) *DoTClient {
+	return NewDoTClientWithPool(serverAddr, tlsServerName, timeout, insecureSkipVerify, rootCAs, enablePadding, DoTPoolOptions{})
 }
 
-// NewDoTClient creates a new DNS-over-TLS client
-func NewDoTClient(serverAddr string, tlsServerName string, timeout time.Duration, insecureSkipVerify bool) *DoTClient {
-	// Configure TLS
+// NewDoTClientWithPool is NewDoTClient with explicit control over idle
+// timeout and pipelining depth.
+func NewDoTClientWithPool(serverAddr string, tlsServerName string, timeout time.Duration, insecureSkipVerify bool, rootCAs *x509.CertPool, enablePadding bool, opts DoTPoolOptions) *DoTClient {
+	// Configure TLS. ClientSessionCache lets repeated (re)connects to the
+	// same server resume the previous TLS session instead of paying a full
+	// handshake, mirroring what real DoT clients like dnsproxy do.
 	tlsConfig := &tls.Config{
 		ServerName:         tlsServerName, // This appears in TLS SNI field
 		InsecureSkipVerify: insecureSkipVerify,
 		MinVersion:         tls.VersionTLS12,
+		RootCAs:            rootCAs,
+		ClientSessionCache: tls.NewLRUClientSessionCache(32),
 	}
 
 	// Create DNS client with TLS transport
@@ -35,54 +72,155 @@ func NewDoTClient(serverAddr string, tlsServerName string, timeout time.Duration
 		TLSConfig: tlsConfig,
 	}
 
-	return &DoTClient{
+	c := &DoTClient{
 		serverAddr:         serverAddr,
 		tlsServerName:      tlsServerName,
 		timeout:            timeout,
 		insecureSkipVerify: insecureSkipVerify,
+		enablePadding:      enablePadding,
 		client:             client,
 	}
+	c.pool = newDoTConnPool(c.dial, opts)
+	return c
+}
+
+// dial opens a fresh pooled TLS connection to key.addr, timing the
+// handshake so Query can attribute latency to connection setup vs. the
+// query itself.
+func (c *DoTClient) dial(ctx context.Context, key poolKey) (*pooledDoTConn, time.Duration, error) {
+	start := time.Now()
+	conn, err := c.client.Dial(key.addr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to dial DoT server: %w", err)
+	}
+	return newPooledDoTConn(conn), time.Since(start), nil
+}
+
+// EnableSPKIPinning constrains future connections to accept only a server
+// certificate whose SubjectPublicKeyInfo hashes (SHA-256) to pinnedHashHex
+// (hex-encoded), instead of relying solely on chain validation against
+// rootCAs/the system trust store. It returns an error if pinnedHashHex isn't
+// a well-formed SHA-256 hex digest, so a typo fails fast at setup time
+// instead of surfacing as an indistinguishable handshake failure later.
+//
+// Go's crypto/tls only invokes VerifyPeerCertificate after normal chain
+// verification already succeeds, which would make pinning a no-op against
+// a self-signed or otherwise untrusted cert. To pin independently of
+// rootCAs/the system trust store, this sets InsecureSkipVerify on the
+// client's TLS config and re-implements the parts of chain verification
+// pinning doesn't replace (expiry and SNI/hostname match) inside the
+// callback itself.
+func (c *DoTClient) EnableSPKIPinning(pinnedHashHex string) error {
+	expected := strings.ToLower(pinnedHashHex)
+	sum, err := hex.DecodeString(expected)
+	if err != nil {
+		return fmt.Errorf("pinned SPKI hash %q is not valid hex: %w", pinnedHashHex, err)
+	}
+	if len(sum) != sha256.Size {
+		return fmt.Errorf("pinned SPKI hash %q is %d bytes, want %d (SHA-256)", pinnedHashHex, len(sum), sha256.Size)
+	}
+
+	c.client.TLSConfig.InsecureSkipVerify = true
+	c.client.TLSConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				continue
+			}
+			got := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if hex.EncodeToString(got[:]) != expected {
+				continue
+			}
+			if err := cert.VerifyHostname(c.tlsServerName); err != nil {
+				return err
+			}
+			now := time.Now()
+			if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+				return fmt.Errorf("pinned certificate is not valid at %s (validity %s to %s)", now, cert.NotBefore, cert.NotAfter)
+			}
+			return nil
+		}
+		return fmt.Errorf("no presented certificate matches pinned SPKI hash %s", expected)
+	}
+	return nil
+}
+
+// EnableControlPlane wires client into future Query calls, pre-declaring
+// each outgoing FQDN under agentID (see AgentConfig's ControlPlaneAddr and
+// AgentID) before it's sent, so the server can join its plan against what
+// it actually observes. The default, a nil client, leaves Query sending
+// queries without pre-declaring them.
+func (c *DoTClient) EnableControlPlane(client *control.Client, agentID string) {
+	c.controlClient = client
+	c.agentID = agentID
 }
 
-// Query sends a DNS query over TLS
+// Query sends a DNS query over TLS, reusing a pooled connection with spare
+// pipelining capacity for this destination, or dialing (and TLS-handshaking)
+// a new one if none is available.
 func (c *DoTClient) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	fqdn := dns.Fqdn(domain)
+
+	if c.controlClient != nil {
+		// Reported synchronously and before the query is sent, so the plan
+		// is always registered before Observe can possibly see the matching
+		// query arrive server-side; a background goroutine here would race
+		// the two, and an unplanned-looking query would corrupt the very
+		// planned-vs-observed report this exists to produce.
+		if err := c.controlClient.ReportQuery(c.agentID, fqdn, "dot"); err != nil {
+			fmt.Printf("[control] failed to report query plan: %v\n", err)
+		}
+	}
+
 	// Build DNS query message
 	// This is identical to plain DNS - the protocol is the same
 	// Only the transport (TLS) is different
 	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.SetQuestion(fqdn, dns.TypeA)
 	msg.RecursionDesired = true
 
+	if c.enablePadding {
+		PadMessage(msg, QueryPaddingBlockSize)
+	}
+
 	// Record query start time
 	queryTime := time.Now()
 
-	// Send the query over TLS
-	// The miekg/dns library handles:
-	// - TLS handshake
-	// - SNI (Server Name Indication)
-	// - Certificate verification (unless InsecureSkipVerify is true)
-	// - Sending DNS message over the encrypted connection
-	response, rtt, err := c.client.Exchange(msg, c.serverAddr)
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	key := poolKey{addr: c.serverAddr, serverName: c.tlsServerName}
+	pc, reused, handshakeRTT, err := c.pool.acquire(ctx, key)
 
 	result := &QueryResult{
-		Domain:    domain,
-		Response:  response,
-		RTT:       rtt,
-		Server:    c.serverAddr,
-		Error:     err,
-		QueryTime: queryTime,
-		Answers:   make([]string, 0),
+		Domain:       domain,
+		Server:       c.serverAddr,
+		QueryTime:    queryTime,
+		Answers:      make([]string, 0),
+		HandshakeRTT: handshakeRTT,
+		Reused:       reused,
+	}
+
+	if err != nil {
+		result.Error = err
+		return result, fmt.Errorf("DoT dial failed: %w", err)
 	}
 
-	// If there was an error, return early
+	// Send the query over the pooled TLS connection. pc.exchange matches the
+	// response back to msg by DNS message ID, which is what lets other
+	// goroutines have their own queries in flight on pc at the same time.
+	response, err := pc.exchange(ctx, msg)
+	result.RTT = time.Since(queryTime)
+
 	if err != nil {
+		result.Error = err
 		return result, fmt.Errorf("DoT query failed: %w", err)
 	}
 
-	// Check if we got a response
 	if response == nil {
 		return result, fmt.Errorf("no response received")
 	}
+	result.Response = response
 
 	// Parse the answer section to extract IP addresses
 	for _, answer := range response.Answer {
@@ -94,9 +232,223 @@ func (c *DoTClient) Query(ctx context.Context, domain string) (*QueryResult, err
 	return result, nil
 }
 
-// Close cleans up resources
+// Close drains and closes every pooled connection.
 func (c *DoTClient) Close() error {
-	// DoT client doesn't maintain persistent connections in our implementation
-	// The miekg/dns library handles connection lifecycle
+	return c.pool.Close()
+}
+
+// dotConnPool manages persistent TLS connections keyed by (serverAddr,
+// tlsServerName), reused across Query calls to avoid paying a fresh TLS
+// handshake per query. Connections past IdleTimeout are closed lazily, the
+// same way ResponseCache ages out entries on Get rather than via a
+// background sweep.
+type dotConnPool struct {
+	mu          sync.Mutex
+	conns       map[poolKey][]*pooledDoTConn
+	dial        func(ctx context.Context, key poolKey) (*pooledDoTConn, time.Duration, error)
+	idleTimeout time.Duration
+	maxInFlight int32
+}
+
+func newDoTConnPool(dial func(ctx context.Context, key poolKey) (*pooledDoTConn, time.Duration, error), opts DoTPoolOptions) *dotConnPool {
+	idleTimeout := opts.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = 30 * time.Second
+	}
+	maxInFlight := opts.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 8
+	}
+
+	return &dotConnPool{
+		conns:       make(map[poolKey][]*pooledDoTConn),
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		maxInFlight: int32(maxInFlight),
+	}
+}
+
+// acquire returns a pooled connection for key with room for another
+// in-flight query, reusing one if available and dialing a fresh one
+// otherwise. The returned bool reports whether the connection was reused.
+func (p *dotConnPool) acquire(ctx context.Context, key poolKey) (*pooledDoTConn, bool, time.Duration, error) {
+	p.mu.Lock()
+	bucket := p.conns[key]
+	live := bucket[:0]
+	var chosen *pooledDoTConn
+	for _, pc := range bucket {
+		if pc.isDead() || pc.idleSince() > p.idleTimeout {
+			pc.close()
+			continue
+		}
+		live = append(live, pc)
+		if chosen == nil && pc.load() < p.maxInFlight {
+			chosen = pc
+		}
+	}
+	p.conns[key] = live
+	p.mu.Unlock()
+
+	if chosen != nil {
+		return chosen, true, 0, nil
+	}
+
+	pc, handshakeRTT, err := p.dial(ctx, key)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	p.mu.Lock()
+	p.conns[key] = append(p.conns[key], pc)
+	p.mu.Unlock()
+
+	return pc, false, handshakeRTT, nil
+}
+
+// Close drains and closes every pooled connection.
+func (p *dotConnPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, bucket := range p.conns {
+		for _, pc := range bucket {
+			pc.close()
+		}
+		delete(p.conns, key)
+	}
 	return nil
 }
+
+// pooledDoTConn wraps a persistent *dns.Conn with RFC 7766 pipelining:
+// multiple queries can be outstanding on the same connection at once,
+// matched back to their caller by DNS message ID via a reader goroutine.
+//
+// We don't drive this with dns.Client.ExchangeWithConn, because that call
+// owns both the write and the following read for its entire duration, which
+// would force every query sharing pc to run strictly one at a time.
+type pooledDoTConn struct {
+	connLifetime
+	conn *dns.Conn
+
+	writeMu sync.Mutex
+
+	pendingMu sync.Mutex
+	pending   map[uint16]chan *dns.Msg
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newPooledDoTConn(conn *dns.Conn) *pooledDoTConn {
+	pc := &pooledDoTConn{
+		conn:    conn,
+		pending: make(map[uint16]chan *dns.Msg),
+		closed:  make(chan struct{}),
+	}
+	pc.touch()
+	go pc.readLoop()
+	return pc
+}
+
+// readLoop dispatches each response to its waiting caller by message ID. A
+// read error (including the server closing the connection) tears pc down
+// and fails every still-pending query.
+func (pc *pooledDoTConn) readLoop() {
+	for {
+		msg, err := pc.conn.ReadMsg()
+		if err != nil {
+			pc.close()
+			return
+		}
+
+		pc.pendingMu.Lock()
+		ch, ok := pc.pending[msg.Id]
+		if ok {
+			delete(pc.pending, msg.Id)
+		}
+		pc.pendingMu.Unlock()
+
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// exchange writes msg and waits for the response matched to it by ID,
+// allowing other goroutines to have their own queries in flight on pc at
+// the same time. It assigns msg.Id itself, overwriting whatever the caller
+// set, so that two queries pipelined on the same pc can never collide on
+// the ID they're matched back by.
+func (pc *pooledDoTConn) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	ch := make(chan *dns.Msg, 1)
+
+	pc.pendingMu.Lock()
+	id := pc.allocateIDLocked()
+	msg.Id = id
+	pc.pending[id] = ch
+	pc.pendingMu.Unlock()
+
+	pc.acquireSlot()
+	defer pc.releaseSlot()
+
+	pc.writeMu.Lock()
+	err := pc.conn.WriteMsg(msg)
+	pc.writeMu.Unlock()
+	if err != nil {
+		pc.pendingMu.Lock()
+		delete(pc.pending, id)
+		pc.pendingMu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("pooled connection closed while awaiting response")
+		}
+		pc.touch()
+		return resp, nil
+	case <-ctx.Done():
+		pc.pendingMu.Lock()
+		delete(pc.pending, id)
+		pc.pendingMu.Unlock()
+		return nil, ctx.Err()
+	case <-pc.closed:
+		return nil, fmt.Errorf("pooled connection closed")
+	}
+}
+
+// allocateIDLocked returns a message ID with no entry currently in
+// pc.pending, so a query pipelined alongside others on pc can never have
+// its response handed to (or stolen by) a different waiter. Caller must
+// hold pc.pendingMu.
+func (pc *pooledDoTConn) allocateIDLocked() uint16 {
+	for {
+		id := dns.Id()
+		if _, taken := pc.pending[id]; !taken {
+			return id
+		}
+	}
+}
+
+// failPending closes out every query still waiting on a response, used when
+// the underlying connection is torn down.
+func (pc *pooledDoTConn) failPending() {
+	pc.pendingMu.Lock()
+	defer pc.pendingMu.Unlock()
+	for id, ch := range pc.pending {
+		close(ch)
+		delete(pc.pending, id)
+	}
+}
+
+func (pc *pooledDoTConn) close() error {
+	var err error
+	pc.closeOnce.Do(func() {
+		pc.markDead()
+		close(pc.closed)
+		err = pc.conn.Close()
+		pc.failPending()
+	})
+	return err
+}
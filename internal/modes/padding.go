@@ -0,0 +1,62 @@
+package modes
+
+import "github.com/miekg/dns"
+
+// QueryPaddingBlockSize is the RFC 8467 "Block-Length Padding" size for
+// queries: pad to the nearest 128 bytes. This mirrors dns.QueryPaddingBlockSize
+// on the server side; it's duplicated rather than imported so this package
+// doesn't need to depend on internal/dns (which depends on us for
+// modes.DNSClient, via dns.Beacon).
+const QueryPaddingBlockSize = 128
+
+// PadMessage attaches (or replaces) an EDNS(0) Padding option on m so that
+// ciphertext length over an encrypted transport doesn't leak the underlying
+// question/answer size, per RFC 7830. The wire-format length is rounded up
+// to the nearest multiple of blockSize, per RFC 8467.
+func PadMessage(m *dns.Msg, blockSize int) {
+	if blockSize <= 0 {
+		return
+	}
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		opt = new(dns.OPT)
+		opt.Hdr.Name = "."
+		opt.Hdr.Rrtype = dns.TypeOPT
+		opt.SetUDPSize(dns.DefaultMsgSize)
+		m.Extra = append(m.Extra, opt)
+	}
+
+	removePadding(opt)
+
+	padding := &dns.EDNS0_PADDING{Padding: []byte{}}
+	opt.Option = append(opt.Option, padding)
+
+	// m.Len() already accounts for the padding option's 4-byte option header,
+	// so the gap to the next block boundary is exactly how much to pad with
+	unpaddedLen := m.Len()
+	target := roundUpToBlock(unpaddedLen, blockSize)
+	if target > unpaddedLen {
+		padding.Padding = make([]byte, target-unpaddedLen)
+	}
+}
+
+// removePadding strips any existing padding option so PadMessage can be
+// called idempotently (e.g. if a message is padded more than once)
+func removePadding(opt *dns.OPT) {
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0PADDING {
+			kept = append(kept, o)
+		}
+	}
+	opt.Option = kept
+}
+
+func roundUpToBlock(length, blockSize int) int {
+	remainder := length % blockSize
+	if remainder == 0 {
+		return length
+	}
+	return length + (blockSize - remainder)
+}
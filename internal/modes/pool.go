@@ -0,0 +1,59 @@
+package modes
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// poolKey identifies a pooled connection by destination and TLS identity.
+// Both DoTClient and DoQClient key their connection pools this way, so a
+// query never needs anything beyond (server, SNI) to find a connection it
+// can reuse.
+type poolKey struct {
+	addr       string
+	serverName string
+}
+
+// connLifetime tracks the idle/in-flight bookkeeping shared by the DoT and
+// DoQ connection pools, so idle eviction and pipelining limits behave the
+// same way regardless of which transport is doing the pooling.
+type connLifetime struct {
+	lastUsed atomic.Value // time.Time
+	inFlight int32        // atomic
+	dead     int32        // atomic bool: set once the underlying conn is torn down
+}
+
+func (l *connLifetime) touch() {
+	l.lastUsed.Store(time.Now())
+}
+
+// idleSince returns how long it's been since the connection was last used
+// for a query. Before the first touch() it reports a zero duration so a
+// brand-new connection is never mistaken for an idle one.
+func (l *connLifetime) idleSince() time.Duration {
+	v := l.lastUsed.Load()
+	if v == nil {
+		return 0
+	}
+	return time.Since(v.(time.Time))
+}
+
+func (l *connLifetime) acquireSlot() {
+	atomic.AddInt32(&l.inFlight, 1)
+}
+
+func (l *connLifetime) releaseSlot() {
+	atomic.AddInt32(&l.inFlight, -1)
+}
+
+func (l *connLifetime) load() int32 {
+	return atomic.LoadInt32(&l.inFlight)
+}
+
+func (l *connLifetime) markDead() {
+	atomic.StoreInt32(&l.dead, 1)
+}
+
+func (l *connLifetime) isDead() bool {
+	return atomic.LoadInt32(&l.dead) == 1
+}
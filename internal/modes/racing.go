@@ -0,0 +1,117 @@
+package modes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RacingClient decorates an ordered list of DNSClients, launching the first
+// immediately and each subsequent one after its own start delay, unless a
+// prior resolver has already returned a successful, non-SERVFAIL answer.
+// It returns the first such answer and cancels the remaining in-flight
+// queries via context. This is the Tailscale forwarder's resolverAndDelay
+// pattern: it lets a beacon try a fast resolver first and fall back to a
+// slower/more-reliable one only if the first one is slow or erroring,
+// which looks like a real stub resolver rather than a single-shot client.
+type RacingClient struct {
+	clients []DNSClient
+	delays  []time.Duration
+}
+
+// NewRacingClient wraps clients, each started delays[i] after Query begins
+// (delays[0] is conventionally zero). delays normally has one entry per
+// client; a short delays slice treats any missing entries as zero (start
+// immediately).
+func NewRacingClient(clients []DNSClient, delays []time.Duration) *RacingClient {
+	return &RacingClient{clients: clients, delays: delays}
+}
+
+// Ensure RacingClient implements the DNSClient interface
+var _ DNSClient = (*RacingClient)(nil)
+
+// racingOutcome pairs a child client's result with the error it returned
+type racingOutcome struct {
+	result *QueryResult
+	err    error
+}
+
+// Query starts every child client on its configured delay and returns the
+// first successful, non-SERVFAIL answer. If every resolver fails or returns
+// SERVFAIL, the first outcome received is returned as-is (its result and
+// its error, if any), so callers still see a response to log/inspect.
+func (c *RacingClient) Query(ctx context.Context, domain string) (*QueryResult, error) {
+	if len(c.clients) == 0 {
+		return nil, fmt.Errorf("racing client: no resolvers configured")
+	}
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan racingOutcome, len(c.clients))
+	timers := make([]*time.Timer, len(c.clients))
+
+	for i, client := range c.clients {
+		i, client := i, client
+		delay := time.Duration(0)
+		if i < len(c.delays) {
+			delay = c.delays[i]
+		}
+		timers[i] = time.AfterFunc(delay, func() {
+			result, err := client.Query(queryCtx, domain)
+			select {
+			case results <- racingOutcome{result: result, err: err}:
+			case <-queryCtx.Done():
+			}
+		})
+	}
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}()
+
+	var fallback racingOutcome
+	haveFallback := false
+
+	for i := 0; i < len(c.clients); i++ {
+		select {
+		case out := <-results:
+			if out.err == nil && isGoodAnswer(out.result) {
+				return out.result, nil
+			}
+			if !haveFallback {
+				fallback = out
+				haveFallback = true
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if haveFallback {
+		return fallback.result, fallback.err
+	}
+	return nil, fmt.Errorf("racing client: no resolver answered")
+}
+
+// Close closes every child client, returning the first error encountered (if
+// any) after attempting to close them all.
+func (c *RacingClient) Close() error {
+	var firstErr error
+	for _, client := range c.clients {
+		if err := client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// isGoodAnswer reports whether result represents a usable response: a
+// non-nil message with an rcode other than SERVFAIL. The transport error
+// returned alongside result is checked by the caller.
+func isGoodAnswer(result *QueryResult) bool {
+	return result != nil && result.Response != nil && result.Response.Rcode != dns.RcodeServerFailure
+}
@@ -0,0 +1,53 @@
+package timing
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DecorrelatedJitter implements the AWS-style "decorrelated jitter" retry
+// backoff: sleep = min(Cap, random_between(Base, prev*3)). Unlike plain
+// exponential backoff, each sleep is randomized relative to the previous
+// one, which avoids synchronized retry storms across many clients without
+// needing them to coordinate.
+//
+// A DecorrelatedJitter is stateful (it remembers the previous delay), so a
+// fresh instance should be created per retry sequence rather than shared
+// across unrelated ones.
+type DecorrelatedJitter struct {
+	Base time.Duration
+	Cap  time.Duration
+
+	mu   sync.Mutex
+	prev time.Duration
+}
+
+// NewDecorrelatedJitter creates a DecorrelatedJitter backoff scheduler.
+func NewDecorrelatedJitter(base, cap time.Duration) *DecorrelatedJitter {
+	return &DecorrelatedJitter{Base: base, Cap: cap, prev: base}
+}
+
+// NextDelay returns the next backoff delay and advances the internal state.
+func (d *DecorrelatedJitter) NextDelay(_ context.Context) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	upper := d.prev * 3
+	if upper < d.Base {
+		upper = d.Base
+	}
+
+	span := int64(upper - d.Base)
+	next := d.Base
+	if span > 0 {
+		next += time.Duration(rand.Int63n(span + 1))
+	}
+	if next > d.Cap {
+		next = d.Cap
+	}
+
+	d.prev = next
+	return next
+}
@@ -0,0 +1,27 @@
+package timing
+
+import (
+	"context"
+	"time"
+)
+
+// Composite layers several Schedulers together by summing their delays,
+// e.g. a PoissonBeacon cadence with a GaussianJitter layered on top for
+// additional human-like noise.
+type Composite struct {
+	Layers []Scheduler
+}
+
+// NewComposite creates a Composite that sums the delay of each layer, in order.
+func NewComposite(layers ...Scheduler) *Composite {
+	return &Composite{Layers: layers}
+}
+
+// NextDelay sums NextDelay across every layer, floored at minDelay.
+func (c *Composite) NextDelay(ctx context.Context) time.Duration {
+	var total time.Duration
+	for _, layer := range c.Layers {
+		total += layer.NextDelay(ctx)
+	}
+	return clamp(total)
+}
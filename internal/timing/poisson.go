@@ -0,0 +1,32 @@
+package timing
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// PoissonBeacon models inter-arrival times as a Poisson process: the wait
+// until the next event is exponentially distributed, which is what a C2
+// implant emitting independent, memoryless beacons actually looks like
+// (as opposed to UniformJitter/GaussianJitter's fixed-cadence-plus-noise).
+type PoissonBeacon struct {
+	// Lambda is the arrival rate in events per second. A higher Lambda
+	// means shorter, more frequent delays.
+	Lambda float64
+}
+
+// NewPoissonBeacon creates a PoissonBeacon scheduler with the given rate
+// (events per second).
+func NewPoissonBeacon(lambda float64) *PoissonBeacon {
+	return &PoissonBeacon{Lambda: lambda}
+}
+
+// NextDelay draws from Exponential(Lambda), floored at minDelay.
+func (p *PoissonBeacon) NextDelay(_ context.Context) time.Duration {
+	if p.Lambda <= 0 {
+		return minDelay
+	}
+	seconds := rand.ExpFloat64() / p.Lambda
+	return clamp(time.Duration(seconds * float64(time.Second)))
+}
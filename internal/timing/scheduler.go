@@ -0,0 +1,74 @@
+// Package timing provides pluggable delay schedules for the agent's beacon
+// loop and retry logic, so the simulator can reproduce realistic C2 cadences
+// (steady intervals, human-like jitter, bursty Poisson arrivals, working-hours
+// throttling) instead of a single fixed delay.
+package timing
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Scheduler decides how long to wait before the next action (a beacon query,
+// a retry attempt, ...). Implementations must be safe for concurrent use,
+// since a single Scheduler is typically shared across a whole beacon loop.
+type Scheduler interface {
+	// NextDelay returns how long to wait before the next action. It does
+	// not block; ctx is accepted so time-of-day-aware schedulers (e.g.
+	// WorkingHours) can read the current time without requiring a
+	// context.Context on the struct itself.
+	NextDelay(ctx context.Context) time.Duration
+}
+
+// minDelay is the floor every Scheduler in this package clamps to, so a
+// beacon loop never busy-loops on a zero or negative delay.
+const minDelay = 1 * time.Second
+
+// clamp returns d, or minDelay if d is below it.
+func clamp(d time.Duration) time.Duration {
+	if d < minDelay {
+		return minDelay
+	}
+	return d
+}
+
+// UniformJitter adds uniformly distributed randomness to a fixed base delay:
+// the result is BaseDelay ± Jitter. This is the simplest profile and matches
+// the simulator's original fixed-cadence-with-jitter beaconing.
+type UniformJitter struct {
+	BaseDelay time.Duration
+	Jitter    time.Duration
+}
+
+// NewUniformJitter creates a UniformJitter scheduler.
+func NewUniformJitter(baseDelay, jitter time.Duration) *UniformJitter {
+	return &UniformJitter{BaseDelay: baseDelay, Jitter: jitter}
+}
+
+// NextDelay returns BaseDelay plus a uniformly random offset in [-Jitter, +Jitter].
+func (u *UniformJitter) NextDelay(_ context.Context) time.Duration {
+	if u.Jitter <= 0 {
+		return clamp(u.BaseDelay)
+	}
+	offset := time.Duration(rand.Int63n(int64(2*u.Jitter+1))) - u.Jitter
+	return clamp(u.BaseDelay + offset)
+}
+
+// GaussianJitter samples delays from a normal distribution, which produces a
+// more human-like cluster around Mean than UniformJitter's hard-edged range.
+type GaussianJitter struct {
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+// NewGaussianJitter creates a GaussianJitter scheduler.
+func NewGaussianJitter(mean, stdDev time.Duration) *GaussianJitter {
+	return &GaussianJitter{Mean: mean, StdDev: stdDev}
+}
+
+// NextDelay returns a sample from Normal(Mean, StdDev), floored at minDelay.
+func (g *GaussianJitter) NextDelay(_ context.Context) time.Duration {
+	sample := float64(g.Mean) + rand.NormFloat64()*float64(g.StdDev)
+	return clamp(time.Duration(sample))
+}
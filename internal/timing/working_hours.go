@@ -0,0 +1,59 @@
+package timing
+
+import (
+	"context"
+	"time"
+)
+
+// WorkingHours switches between two delegate Schedulers depending on the
+// current local time, so a beacon can simulate activity that piggybacks on
+// a user's working day (high rate 09:00-17:00, low rate outside those hours)
+// rather than beaconing at a constant, easily-fingerprinted rate around the
+// clock. Only the hour of day is checked; weekends are treated like weekdays.
+type WorkingHours struct {
+	// Location is the time zone working hours are evaluated in. Defaults to
+	// time.Local if nil.
+	Location *time.Location
+
+	// ActiveStartHour and ActiveEndHour bound the high-rate window, in
+	// 24-hour local time (e.g. 9 and 17 for 09:00-17:00).
+	ActiveStartHour int
+	ActiveEndHour   int
+
+	// Active is used during the working-hours window.
+	Active Scheduler
+	// Idle is used outside of it.
+	Idle Scheduler
+
+	// now is overridable for tests; defaults to time.Now.
+	now func() time.Time
+}
+
+// NewWorkingHours creates a WorkingHours scheduler that uses active during
+// [startHour, endHour) local time and idle otherwise.
+func NewWorkingHours(startHour, endHour int, active, idle Scheduler) *WorkingHours {
+	return &WorkingHours{
+		ActiveStartHour: startHour,
+		ActiveEndHour:   endHour,
+		Active:          active,
+		Idle:            idle,
+	}
+}
+
+// NextDelay delegates to Active or Idle depending on the current hour.
+func (w *WorkingHours) NextDelay(ctx context.Context) time.Duration {
+	nowFn := w.now
+	if nowFn == nil {
+		nowFn = time.Now
+	}
+	loc := w.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	hour := nowFn().In(loc).Hour()
+	if hour >= w.ActiveStartHour && hour < w.ActiveEndHour {
+		return w.Active.NextDelay(ctx)
+	}
+	return w.Idle.NextDelay(ctx)
+}
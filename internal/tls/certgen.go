@@ -0,0 +1,191 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EnsureCertificate makes sure certFile/keyFile exist, generating a
+// self-signed CA and a leaf certificate (signed by that CA) for domain if
+// they don't. The CA certificate is also written to caFile so clients can
+// load it as a trusted root instead of disabling verification.
+//
+// This mirrors what tools like blocky do for their DoH/DoT listeners, so
+// users don't have to run openssl before the simulator works.
+func EnsureCertificate(certFile, keyFile, caFile, domain string) error {
+	if fileExists(certFile) && fileExists(keyFile) {
+		return nil
+	}
+
+	fmt.Printf("No certificate found at %s, generating a self-signed one for %q...\n", certFile, domain)
+
+	caCert, caKey, err := generateCA()
+	if err != nil {
+		return fmt.Errorf("failed to generate CA: %w", err)
+	}
+
+	leafCert, leafKey, err := generateLeaf(domain, caCert, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to generate leaf certificate: %w", err)
+	}
+
+	if err := writeCertAndKey(certFile, keyFile, leafCert, leafKey); err != nil {
+		return fmt.Errorf("failed to write leaf certificate: %w", err)
+	}
+
+	if err := writeCert(caFile, caCert); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	fmt.Printf("Generated CA certificate at %s and leaf certificate at %s\n", caFile, certFile)
+	return nil
+}
+
+// LoadCAPool reads a PEM-encoded CA certificate and returns it as a CertPool
+// suitable for tls.Config.RootCAs, so clients can verify our self-signed chain
+func LoadCAPool(caFile string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("failed to parse CA certificate from %s", caFile)
+	}
+
+	return pool, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// generateCA creates a 10-year ECDSA P-256 self-signed CA certificate
+func generateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "DNS Encryption Simulator CA",
+			Organization: []string{"dns-encryption-simulator"},
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// generateLeaf creates a 5-year ECDSA P-256 leaf certificate signed by the CA,
+// valid for domain plus the loopback addresses used throughout this module
+func generateLeaf(domain string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: domain},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{domain},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, limit)
+}
+
+func writeCertAndKey(certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) error {
+	if err := writeCert(certFile, cert); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0755); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	keyOut, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for writing: %w", keyFile, err)
+	}
+	defer keyOut.Close()
+
+	return pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+}
+
+func writeCert(path string, cert *x509.Certificate) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for writing: %w", path, err)
+	}
+	defer out.Close()
+
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
@@ -0,0 +1,47 @@
+package tls
+
+import (
+	stdtls "crypto/tls"
+	"net"
+	"time"
+
+	"github.com/faanross/dns-encryption-simulator/internal/metrics"
+)
+
+// TimingListener wraps a raw TCP listener, performing the TLS handshake on
+// each accepted connection eagerly (rather than lazily on first read) so the
+// handshake's duration can be recorded under protocol's label.
+type TimingListener struct {
+	net.Listener
+	config   *stdtls.Config
+	protocol string
+}
+
+// NewTimingListener wraps raw with TLS using config, instrumenting each
+// handshake's duration under protocol's label (e.g. "doh", "dot")
+func NewTimingListener(raw net.Listener, config *stdtls.Config, protocol string) *TimingListener {
+	return &TimingListener{Listener: raw, config: config, protocol: protocol}
+}
+
+// Accept accepts the next connection and completes its TLS handshake before
+// returning it. A connection that fails its handshake is dropped and Accept
+// tries again, so one bad client can't take down the whole listener.
+func (l *TimingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := stdtls.Server(conn, l.config)
+
+		start := time.Now()
+		if err := tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			continue
+		}
+		metrics.TLSHandshakeDuration.WithLabelValues(l.protocol).Observe(time.Since(start).Seconds())
+
+		return tlsConn, nil
+	}
+}
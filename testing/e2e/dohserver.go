@@ -0,0 +1,120 @@
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	encdns "github.com/faanross/dns-encryption-simulator/internal/dns"
+	ourtls "github.com/faanross/dns-encryption-simulator/internal/tls"
+	"github.com/miekg/dns"
+)
+
+// ProxyHandler forwards every query verbatim to upstream over UDP. It's the
+// glue between an in-process DoHServer and a MiniDNSServer, standing in for
+// the production ForwardingHandler (which also answers an authoritative
+// zone locally) when a test just wants a plain pass-through.
+type ProxyHandler struct {
+	upstream string
+	client   *dns.Client
+}
+
+// NewProxyHandler builds a ProxyHandler that forwards to upstream (IP:port)
+func NewProxyHandler(upstream string) *ProxyHandler {
+	return &ProxyHandler{
+		upstream: upstream,
+		client:   &dns.Client{Net: "udp", Timeout: 5 * time.Second},
+	}
+}
+
+// ServeDNS implements dns.Handler
+func (p *ProxyHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	response, _, err := p.client.Exchange(r, p.upstream)
+	if err != nil {
+		fail := new(dns.Msg)
+		fail.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(fail)
+		return
+	}
+	response.Id = r.Id
+	w.WriteMsg(response)
+}
+
+// DoHServerHarness is an in-process DoH server listening on a real loopback
+// port with an auto-generated, trusted-by-CAFile certificate.
+type DoHServerHarness struct {
+	Addr   string // host:port the server is listening on
+	URL    string // full https://.../dns-query endpoint
+	CAFile string // CA certificate a DoHClient should trust
+
+	server *encdns.DoHServer
+}
+
+// StartDoHServer generates a throwaway CA/leaf cert pair under t.TempDir(),
+// starts an encdns.DoHServer wrapping handler on a free loopback port, and
+// registers its shutdown with t.Cleanup.
+func StartDoHServer(t *testing.T, handler dns.Handler) (*DoHServerHarness, error) {
+	t.Helper()
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "leaf.pem")
+	keyFile := filepath.Join(dir, "leaf-key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ourtls.EnsureCertificate(certFile, keyFile, caFile, "127.0.0.1"); err != nil {
+		return nil, fmt.Errorf("failed to generate test certificate: %w", err)
+	}
+
+	server := encdns.NewDoHServer(handler, addr, certFile, keyFile)
+	go server.Start()
+
+	if err := waitForDial("tcp", addr, 2*time.Second); err != nil {
+		return nil, fmt.Errorf("DoH server never came up on %s: %w", addr, err)
+	}
+
+	t.Cleanup(func() {
+		server.Stop()
+	})
+
+	return &DoHServerHarness{
+		Addr:   addr,
+		URL:    fmt.Sprintf("https://%s/dns-query", addr),
+		CAFile: caFile,
+		server: server,
+	}, nil
+}
+
+// freePort asks the OS for a free TCP port by binding to :0 and releasing it
+// immediately; DoHServer binds its own listener internally, so this is the
+// simplest way to hand it a known, unoccupied port.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForDial polls addr until a TCP connection succeeds or timeout elapses
+func waitForDial(network, addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout(network, addr, 50*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = err
+		time.Sleep(20 * time.Millisecond)
+	}
+	return lastErr
+}
@@ -0,0 +1,155 @@
+// Package e2e provides an in-process end-to-end test harness: a miniature
+// authoritative DNS server plus helpers to stand up the simulator's own
+// DoH server subsystem in front of it, so the full client -> transport ->
+// server -> origin chain can be exercised over loopback sockets only.
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// MiniDNSServer is a lightweight authoritative DNS server for tests: it
+// answers configured A/AAAA/TXT records over UDP and NXDOMAINs everything
+// else, while recording every qname it's asked for so a test can assert
+// what actually reached the origin.
+type MiniDNSServer struct {
+	conn   net.PacketConn
+	server *dns.Server
+
+	mu             sync.Mutex
+	records        map[string][]dns.RR
+	queries        []string
+	wildcardDomain string
+	wildcardA      net.IP
+}
+
+// NewMiniDNSServer binds to 127.0.0.1:0 and returns a server ready to Start.
+func NewMiniDNSServer() (*MiniDNSServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind mini DNS server: %w", err)
+	}
+
+	m := &MiniDNSServer{
+		conn:    conn,
+		records: make(map[string][]dns.RR),
+	}
+	m.server = &dns.Server{PacketConn: conn, Handler: m}
+	return m, nil
+}
+
+// Addr returns the server's bound UDP address (IP:port), suitable as a
+// PlainDNSClientAdapter resolver or a forwarding upstream target.
+func (m *MiniDNSServer) Addr() string {
+	return m.conn.LocalAddr().String()
+}
+
+// Start begins serving in the background. Call Close to stop it.
+func (m *MiniDNSServer) Start() {
+	go m.server.ActivateAndServe()
+}
+
+// Close shuts down the server
+func (m *MiniDNSServer) Close() error {
+	return m.server.Shutdown()
+}
+
+// AddA registers an A record answer for the exact qname
+func (m *MiniDNSServer) AddA(qname string, ip net.IP) {
+	fqdn := dns.Fqdn(qname)
+	m.addRecord(fqdn, &dns.A{
+		Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   ip,
+	})
+}
+
+// AddAAAA registers an AAAA record answer for the exact qname
+func (m *MiniDNSServer) AddAAAA(qname string, ip net.IP) {
+	fqdn := dns.Fqdn(qname)
+	m.addRecord(fqdn, &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: fqdn, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+		AAAA: ip,
+	})
+}
+
+// AddTXT registers a TXT record answer for the exact qname
+func (m *MiniDNSServer) AddTXT(qname string, txt ...string) {
+	fqdn := dns.Fqdn(qname)
+	m.addRecord(fqdn, &dns.TXT{
+		Hdr: dns.RR_Header{Name: fqdn, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+		Txt: txt,
+	})
+}
+
+// AddWildcardA answers any A query for a name under domain with ip,
+// regardless of the exact label queried. This is for beacon-style tests,
+// whose subdomains are generated randomly rather than pre-registered.
+func (m *MiniDNSServer) AddWildcardA(domain string, ip net.IP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wildcardDomain = dns.Fqdn(domain)
+	m.wildcardA = ip
+}
+
+func (m *MiniDNSServer) addRecord(fqdn string, rr dns.RR) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[fqdn] = append(m.records[fqdn], rr)
+}
+
+// Queries returns every qname the server has been asked for, in the order
+// the queries arrived.
+func (m *MiniDNSServer) Queries() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, len(m.queries))
+	copy(out, m.queries)
+	return out
+}
+
+// ServeDNS implements dns.Handler
+func (m *MiniDNSServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	response := new(dns.Msg)
+	response.SetReply(r)
+
+	if len(r.Question) == 0 {
+		w.WriteMsg(response)
+		return
+	}
+	q := r.Question[0]
+
+	m.mu.Lock()
+	m.queries = append(m.queries, q.Name)
+	matched := matchingRRs(m.records[q.Name], q.Qtype)
+	if len(matched) == 0 && m.wildcardA != nil && q.Qtype == dns.TypeA && strings.HasSuffix(q.Name, m.wildcardDomain) {
+		matched = []dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   m.wildcardA,
+		}}
+	}
+	m.mu.Unlock()
+
+	if len(matched) == 0 {
+		response.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(response)
+		return
+	}
+
+	response.Answer = matched
+	w.WriteMsg(response)
+}
+
+func matchingRRs(rrs []dns.RR, qtype uint16) []dns.RR {
+	var matched []dns.RR
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qtype {
+			matched = append(matched, rr)
+		}
+	}
+	return matched
+}